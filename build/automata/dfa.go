@@ -1,234 +1,165 @@
 package automata
 
 import (
+	"cmp"
+	"encoding/binary"
+
 	"github.com/fabiouggeri/page/util"
 	"golang.org/x/exp/slices"
 )
 
+// dfaState is a state of the DFA being built, standing for a set of NFA states
+// closed under the epsilon transitions.
 type dfaState struct {
-	initial     bool
-	final       bool
-	nfaStates   *util.Set[*State]
-	transitions map[rune]*util.Set[*State]
+	nfaStates []*State
+	targets   map[Interval]int
+}
+
+// subsetBuilder builds the DFA states by the subset construction. The DFA
+// states are found by the keys of their sets of NFA states, and the epsilon
+// closures of the NFA states are computed once.
+type subsetBuilder struct {
+	intervals []Interval
+	states    []*dfaState
+	indexes   map[string]int
+	closures  map[*State][]*State
 }
 
 // NFAToDFA converts a non-deterministic finite automaton (NFA) represented by its start state
 // to a deterministic finite automaton (DFA), also represented by its start state.
 //
 // The conversion process involves the following steps:
-// 1. Determine all symbols used in the NFA.
+// 1. Split the intervals of symbols used in the NFA in disjoint intervals.
 // 2. Create the initial DFA state from the epsilon closure of the NFA's start state.
-// 3. Iteratively build DFA states and their transitions based on the NFA's transition function and symbols.
+// 3. Iteratively build DFA states and their transitions based on the NFA's transition function and intervals.
 // 4. Construct the complete DFA from the generated DFA states.
 // 5. Minimize the DFA to reduce the number of states while preserving its language recognition capability.
+// 6. Join the adjacent intervals of the transitions to the same state.
 //
-// The function returns the start state of the minimized DFA.
+// The function returns the start state of the minimized DFA, whose id is 0.
 func NFAToDFA(state *State) *State {
-	allSymbols := state.AllSymbols()
-	dfaStates := make([]*dfaState, 0)
-	dfaStates = append(dfaStates, newDFAState(util.NewSet(state.EpsilonClosures().Items()...)))
-	for i := 0; i < len(dfaStates); i++ {
-		dfaState := dfaStates[i]
-		dfaStates = buildDFATransitions(dfaStates, allSymbols, dfaState)
-	}
-	dfa := buildDFA(dfaStates)
-	return minimizeDFA(dfa)
+	return mergeTransitions(minimizeDFA(subsetDFA(state)))
 }
 
-func buildDFATransitions(dfaStates []*dfaState, allSymbols []rune, dfaState *dfaState) []*dfaState {
-	// percorre os estados NFA do novo estado DFA
-	for _, nfaState := range dfaState.nfaStates.Items() {
-		for _, symbol := range allSymbols {
-			addSymbolTargets(dfaState, nfaState, symbol)
-		}
+// subsetDFA builds the DFA of the NFA by the subset construction, with the
+// transitions on the disjoint intervals of the NFA.
+func subsetDFA(state *State) *State {
+	b := &subsetBuilder{
+		intervals: SplitIntervals(state.AllIntervals()),
+		states:    make([]*dfaState, 0),
+		indexes:   make(map[string]int),
+		closures:  make(map[*State][]*State),
 	}
-	for _, dfaTransition := range dfaState.transitions {
-		if !foundDFAState(dfaStates, dfaTransition) {
-			dfaStates = append(dfaStates, newDFAState(dfaTransition))
-		}
+	b.addState(b.closure([]*State{state}))
+	for i := 0; i < len(b.states); i++ {
+		b.buildTransitions(b.states[i])
 	}
-	return dfaStates
+	return b.buildDFA()
 }
 
-func addSymbolTargets(dfaState *dfaState, nfaState *State, symbol rune) {
-	if nfaState.initial {
-		dfaState.initial = true
-	}
-	if nfaState.final {
-		dfaState.final = true
-	}
-	targets := util.NewSet[*State]()
-	symbolTargets := nfaState.Targets(symbol)
-	for _, target := range symbolTargets.Items() {
-		targets.AddAll(target.EpsilonClosures().Items()...)
-	}
-	if targets.Length() > 0 {
-		dfaTransition, found := dfaState.transitions[symbol]
+// closure returns the epsilon closure of the NFA states, sorted by id.
+func (b *subsetBuilder) closure(nfaStates []*State) []*State {
+	set := make(map[*State]struct{})
+	for _, nfaState := range nfaStates {
+		stateClosure, found := b.closures[nfaState]
 		if !found {
-			dfaTransition = util.NewSet[*State]()
-			dfaState.transitions[symbol] = dfaTransition
+			stateClosure = nfaState.EpsilonClosures().Items()
+			b.closures[nfaState] = stateClosure
 		}
-		dfaTransition.AddAll(targets.Items()...)
-	}
-}
-
-func newDFAState(nfaStates *util.Set[*State]) *dfaState {
-	return &dfaState{nfaStates: nfaStates, transitions: make(map[rune]*util.Set[*State])}
-}
-
-func foundDFAState(dfaStates []*dfaState, nfaStates *util.Set[*State]) bool {
-	for _, d := range dfaStates {
-		if d.nfaStates.Equals(nfaStates) {
-			return true
+		for _, s := range stateClosure {
+			set[s] = struct{}{}
 		}
 	}
-	return false
+	closure := make([]*State, 0, len(set))
+	for s := range set {
+		closure = append(closure, s)
+	}
+	slices.SortFunc(closure, func(a, b *State) int { return cmp.Compare(a.id, b.id) })
+	return closure
 }
 
-func buildDFA(dfaStates []*dfaState) *State {
-	var initialState *State
-	nextId := int32(0)
-	states := make([]*State, 0, len(dfaStates))
-	for _, dfaState := range dfaStates {
-		s := NewState(nextId, dfaState.initial, dfaState.final)
-		states = append(states, s)
-		checkIsFinal(s, dfaState)
-		nextId++
-		if s.initial {
-			initialState = s
-		}
+// addState returns the index of the DFA state of the closed and sorted set of
+// NFA states, adding the state when it is new.
+func (b *subsetBuilder) addState(nfaStates []*State) int {
+	key := make([]byte, 0, len(nfaStates)*4)
+	for _, nfaState := range nfaStates {
+		key = binary.LittleEndian.AppendUint32(key, uint32(nfaState.id))
 	}
-	for index, dfaState := range dfaStates {
-		for symbol, targets := range dfaState.transitions {
-			targetIndex := findDfaState(dfaStates, targets)
-			states[index].AddTransitions(symbol, states[targetIndex])
-		}
+	if index, found := b.indexes[string(key)]; found {
+		return index
 	}
-	return initialState
+	index := len(b.states)
+	b.states = append(b.states, &dfaState{nfaStates: nfaStates, targets: make(map[Interval]int)})
+	b.indexes[string(key)] = index
+	return index
 }
 
-func checkIsFinal(state *State, dfaState *dfaState) {
-	for _, nfaState := range dfaState.nfaStates.Items() {
-		for _, closure := range nfaState.EpsilonClosures().Items() {
-			if closure.final {
-				state.final = true
-				state.rulesTypes.AddAll(closure.rulesTypes.Items()...)
+// buildTransitions adds the transitions of the DFA state on each of the
+// disjoint intervals to the DFA state of the closure of the NFA targets.
+func (b *subsetBuilder) buildTransitions(d *dfaState) {
+	targets := make(map[int][]*State)
+	for _, nfaState := range d.nfaStates {
+		for interval, transition := range nfaState.transitions {
+			if interval == epsilonInterval {
+				continue
+			}
+			for i := FirstInterval(b.intervals, interval.Start); i < len(b.intervals) && b.intervals[i].End <= interval.End; i++ {
+				targets[i] = append(targets[i], transition.Items()...)
 			}
 		}
 	}
-}
-
-func findDfaState(allStates []*dfaState, targets *util.Set[*State]) int {
-	for index, dfaState := range allStates {
-		if dfaState.nfaStates.Equals(targets) {
-			return index
-		}
+	indexes := make([]int, 0, len(targets))
+	for i := range targets {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+	for _, i := range indexes {
+		d.targets[b.intervals[i]] = b.addState(b.closure(targets[i]))
 	}
-	return -1
-}
-
-func minimizeDFA(state *State) *State {
-	allSymbols := state.AllSymbols()
-	allStates := state.AllStates()
-	slices.SortFunc(allStates, func(a, b *State) int { return int(a.id - b.id) })
-
-	statesTable := buildStatesTable(allStates)
-	markPairStates(statesTable, allStates)
-	checkUnmarkedPairs(statesTable, allStates, allSymbols)
-	return combineUnmarkedStates(statesTable, allStates)
 }
 
-func combineUnmarkedStates(statesTable [][]bool, allStates []*State) *State {
-	var initialState *State
-	nextId := int32(0)
-	newStates := make(map[int]*State)
-	for s1Id := 1; s1Id < len(statesTable); s1Id++ {
-		s1 := allStates[s1Id]
-		combine := false
-		row := statesTable[s1Id]
-		for s2Id := 0; s2Id < s1Id; s2Id++ {
-			if !row[s2Id] {
-				combine = true
-				s2 := allStates[s2Id]
-				combinedState := NewState(nextId, s1.initial || s2.initial, s1.final || s2.final)
-				if combinedState.final {
-					combinedState.rulesTypes.AddAll(s1.RulesTypes()...)
-					combinedState.rulesTypes.AddAll(s2.RulesTypes()...)
-				}
-				newStates[s1Id] = combinedState
-				newStates[s2Id] = combinedState
-			}
-		}
-		if !combine {
-			newState := NewState(nextId, s1.initial, s1.final)
-			if newState.final {
-				newState.rulesTypes.AddAll(s1.RulesTypes()...)
+func (b *subsetBuilder) buildDFA() *State {
+	states := make([]*State, len(b.states))
+	for index, d := range b.states {
+		states[index] = NewState(int32(index), index == 0, false)
+		for _, nfaState := range d.nfaStates {
+			if nfaState.final {
+				states[index].final = true
+				states[index].rulesTypes.AddAll(nfaState.rulesTypes.Items()...)
 			}
-			newStates[s1Id] = newState
 		}
 	}
-	for _, s := range allStates {
-		newState := newStates[int(s.id)]
-		for symbol, targets := range s.transitions {
-			target := targets.Items()[0]
-			newTarget := allStates[target.id]
-			newState.AddTransitions(symbol, newTarget)
-		}
-		if newState.initial {
-			initialState = newState
+	for index, d := range b.states {
+		for interval, target := range d.targets {
+			states[index].AddIntervalTransitions(interval, states[target])
 		}
 	}
-	return initialState
+	return states[0]
 }
 
-func checkUnmarkedPairs(statesTable [][]bool, allStates []*State, allSymbols []Symbol) {
-	repeat := true
-	for repeat {
-		repeat = false
-		for s1Id := 1; s1Id < len(statesTable); s1Id++ {
-			row := statesTable[s1Id]
-			for s2Id := 0; s2Id < s1Id; s2Id++ {
-				if !row[s2Id] && markState(statesTable, allStates, s1Id, s2Id, allSymbols) {
-					row[s2Id] = true
-					repeat = true
-				}
+// mergeTransitions joins the adjacent intervals of the transitions of each state
+// of the DFA to the same target.
+func mergeTransitions(dfa *State) *State {
+	for _, s := range dfa.AllStates() {
+		transitions := make(map[Interval]*util.Set[*State], len(s.transitions))
+		var merged Interval
+		var mergedTarget *State
+		for _, interval := range s.Intervals() {
+			target := s.transitions[interval].Items()[0]
+			if target == mergedTarget && merged.End+1 == interval.Start {
+				merged.End = interval.End
+				continue
 			}
-		}
-	}
-}
-
-func markState(statesTable [][]bool, allStates []*State, s1Id, s2Id int, allSymbols []Symbol) bool {
-	s1 := allStates[s1Id]
-	s2 := allStates[s2Id]
-	for _, symbol := range allSymbols {
-		targetsS1 := s1.transitions[symbol]
-		targetsS2 := s2.transitions[symbol]
-		if targetsS1 != nil && targetsS2 != nil {
-			targetS1 := targetsS1.Items()[0]
-			targetS2 := targetsS2.Items()[0]
-			if statesTable[targetS1.id][targetS2.id] {
-				return true
+			if mergedTarget != nil {
+				transitions[merged] = util.NewSet(mergedTarget)
 			}
+			merged = interval
+			mergedTarget = target
 		}
-	}
-	return false
-}
-
-func buildStatesTable(allStates []*State) [][]bool {
-	statesTable := make([][]bool, len(allStates))
-	for row := range statesTable {
-		statesTable[row] = make([]bool, len(allStates))
-	}
-	return statesTable
-}
-
-func markPairStates(statesTable [][]bool, allStates []*State) {
-	for s1Id := 1; s1Id < len(statesTable); s1Id++ {
-		row := statesTable[s1Id]
-		for s2Id := 0; s2Id < s1Id; s2Id++ {
-			s1 := allStates[s1Id]
-			s2 := allStates[s2Id]
-			row[s2Id] = s1.final && !s2.final
+		if mergedTarget != nil {
+			transitions[merged] = util.NewSet(mergedTarget)
 		}
+		s.transitions = transitions
 	}
+	return dfa
 }
@@ -0,0 +1,7 @@
+package automata
+
+// SubsetDFA and MinimizeDFA expose the steps of NFAToDFA to the tests.
+var (
+	SubsetDFA   = subsetDFA
+	MinimizeDFA = minimizeDFA
+)
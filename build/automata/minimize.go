@@ -0,0 +1,228 @@
+package automata
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// splitter is a block of the partition whose predecessors on a symbol split
+// the other blocks.
+type splitter struct {
+	block  int
+	symbol int
+}
+
+// partition is the partition of the states of a DFA in blocks of states that
+// can not be told apart yet. The DFA is completed with a dead state, the target
+// of the missing transitions.
+type partition struct {
+	symbolsCount int
+	blocks       [][]int32
+	blockOf      []int
+	// sources lists the sources of the transitions on each symbol to each
+	// state, starting at offsets[symbol][state].
+	offsets [][]int32
+	sources [][]int32
+	work    []splitter
+	inWork  []bool
+	moved   [][]int32
+	touched []int
+}
+
+// minimizeDFA merges the equivalent states of the DFA by the partition
+// refinement of Hopcroft. The states start in blocks by the rules they
+// accept, and a block is split while some of its states move on a symbol to a
+// block and others do not. The initial state stays alone, so no transition
+// targets it, and the states that do not lead to a final state are dropped.
+//
+// The transitions of the DFA must be on disjoint intervals, the same for all
+// states, and the ids of the states must go from 0, the initial state, to the
+// number of states less one.
+func minimizeDFA(dfa *State) *State {
+	states := dfa.AllStates()
+	slices.SortFunc(states, func(a, b *State) int { return cmp.Compare(a.id, b.id) })
+	intervals := dfa.AllIntervals()
+	slices.SortFunc(intervals, func(a, b Interval) int { return cmp.Compare(a.Start, b.Start) })
+	p := newPartition(states, intervals)
+	p.refine()
+	return p.buildDFA(states)
+}
+
+func newPartition(states []*State, intervals []Interval) *partition {
+	dead := int32(len(states))
+	symbols := make(map[Interval]int, len(intervals))
+	for index, interval := range intervals {
+		symbols[interval] = index
+	}
+	p := &partition{
+		symbolsCount: len(intervals),
+		blockOf:      make([]int, len(states)+1),
+		offsets:      make([][]int32, len(intervals)),
+		sources:      make([][]int32, len(intervals)),
+	}
+	targets := make([][]int32, len(intervals))
+	for symbol := range targets {
+		targets[symbol] = make([]int32, len(states)+1)
+		for i := range targets[symbol] {
+			targets[symbol][i] = dead
+		}
+	}
+	for _, s := range states {
+		for interval, transition := range s.transitions {
+			targets[symbols[interval]][s.id] = transition.Items()[0].id
+		}
+	}
+	for symbol, symbolTargets := range targets {
+		offsets := make([]int32, len(symbolTargets)+1)
+		for _, target := range symbolTargets {
+			offsets[target+1]++
+		}
+		for i := 1; i < len(offsets); i++ {
+			offsets[i] += offsets[i-1]
+		}
+		sources := make([]int32, len(symbolTargets))
+		next := slices.Clone(offsets)
+		for source, target := range symbolTargets {
+			sources[next[target]] = int32(source)
+			next[target]++
+		}
+		p.offsets[symbol] = offsets
+		p.sources[symbol] = sources
+	}
+	keys := make(map[string]int)
+	for id := 0; id <= len(states); id++ {
+		key := "D"
+		if id == 0 {
+			key = "I"
+		} else if id < len(states) && states[id].final {
+			key = rulesTypesKey(states[id])
+		}
+		block, found := keys[key]
+		if !found {
+			block = p.newBlock()
+			keys[key] = block
+		}
+		p.blocks[block] = append(p.blocks[block], int32(id))
+		p.blockOf[id] = block
+	}
+	for block := range p.blocks {
+		for symbol := 0; symbol < p.symbolsCount; symbol++ {
+			p.push(block, symbol)
+		}
+	}
+	return p
+}
+
+// rulesTypesKey identifies the rules accepted by a final state.
+func rulesTypesKey(s *State) string {
+	ids := make([]int, 0, s.rulesTypes.Length())
+	for _, rt := range s.rulesTypes.Items() {
+		ids = append(ids, int(rt.id))
+	}
+	slices.Sort(ids)
+	key := &strings.Builder{}
+	key.WriteRune('F')
+	for _, id := range ids {
+		key.WriteRune(',')
+		key.WriteString(strconv.Itoa(id))
+	}
+	return key.String()
+}
+
+func (p *partition) newBlock() int {
+	p.blocks = append(p.blocks, make([]int32, 0))
+	p.moved = append(p.moved, make([]int32, 0))
+	p.inWork = append(p.inWork, make([]bool, p.symbolsCount)...)
+	return len(p.blocks) - 1
+}
+
+func (p *partition) push(block int, symbol int) {
+	if !p.inWork[block*p.symbolsCount+symbol] {
+		p.inWork[block*p.symbolsCount+symbol] = true
+		p.work = append(p.work, splitter{block: block, symbol: symbol})
+	}
+}
+
+func (p *partition) refine() {
+	for len(p.work) > 0 {
+		w := p.work[len(p.work)-1]
+		p.work = p.work[:len(p.work)-1]
+		p.inWork[w.block*p.symbolsCount+w.symbol] = false
+		offsets := p.offsets[w.symbol]
+		sources := p.sources[w.symbol]
+		for _, target := range p.blocks[w.block] {
+			for _, source := range sources[offsets[target]:offsets[target+1]] {
+				block := p.blockOf[source]
+				if len(p.moved[block]) == 0 {
+					p.touched = append(p.touched, block)
+				}
+				p.moved[block] = append(p.moved[block], source)
+			}
+		}
+		for _, block := range p.touched {
+			if len(p.moved[block]) < len(p.blocks[block]) {
+				p.split(block)
+			}
+			p.moved[block] = p.moved[block][:0]
+		}
+		p.touched = p.touched[:0]
+	}
+}
+
+// split moves the states of the block moved by the last splitter to a new block.
+func (p *partition) split(block int) {
+	newBlock := p.newBlock()
+	p.blocks[newBlock] = slices.Clone(p.moved[block])
+	for _, id := range p.blocks[newBlock] {
+		p.blockOf[id] = newBlock
+	}
+	kept := make([]int32, 0, len(p.blocks[block])-len(p.blocks[newBlock]))
+	for _, id := range p.blocks[block] {
+		if p.blockOf[id] == block {
+			kept = append(kept, id)
+		}
+	}
+	p.blocks[block] = kept
+	for symbol := 0; symbol < p.symbolsCount; symbol++ {
+		if p.inWork[block*p.symbolsCount+symbol] || len(p.blocks[newBlock]) <= len(p.blocks[block]) {
+			p.push(newBlock, symbol)
+		} else {
+			p.push(block, symbol)
+		}
+	}
+}
+
+// buildDFA creates a state for each block, but the block of the dead state,
+// with the transitions of the first state of the block.
+func (p *partition) buildDFA(states []*State) *State {
+	deadBlock := p.blockOf[len(states)]
+	newStates := make([]*State, len(p.blocks))
+	nextId := int32(0)
+	for _, s := range states {
+		block := p.blockOf[s.id]
+		if block == deadBlock || newStates[block] != nil {
+			continue
+		}
+		newState := NewState(nextId, s.initial, s.final)
+		newState.rulesTypes.AddAll(s.RulesTypes()...)
+		newStates[block] = newState
+		nextId++
+	}
+	built := make([]bool, len(p.blocks))
+	for _, s := range states {
+		block := p.blockOf[s.id]
+		if block == deadBlock || built[block] {
+			continue
+		}
+		built[block] = true
+		for interval, transition := range s.transitions {
+			if target := newStates[p.blockOf[transition.Items()[0].id]]; target != nil {
+				newStates[block].AddIntervalTransitions(interval, target)
+			}
+		}
+	}
+	return newStates[p.blockOf[0]]
+}
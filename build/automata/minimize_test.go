@@ -0,0 +1,209 @@
+package automata_test
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/build/automata"
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/vocabulary"
+)
+
+const keywordsGrammar = `grammar Keywords;
+
+Program : (Keyword | Operator | Ident | Number)* EOI;
+
+@SkipNode
+Keyword : "function":4 | "procedure":4 | "return":4 | "endif":3 | "enddo":3 | "end" | "if" | "in" | Ident;
+
+@SkipNode
+Operator : ':=' | ':' | '::' | '+=' | '++' | '+' | '.and.' | '.or.' | '.not.' | Number;
+
+@Token
+Ident : ([a-z] | [A-Z] | '_') ([a-z] | [A-Z] | [0-9] | '_')*;
+
+@Token
+Number : [0-9]+ ('.' [0-9]+)? | '.' [0-9]+ | '0x' ([0-9] | [a-f] | [A-F])+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+const literalsGrammar = `grammar Literals;
+
+Program : (String | Char | Comment)* EOI;
+
+@Token
+String : '"' (('"' | '\\' | '\n')! | ('\\' ('\n')!))* '"';
+
+@Token
+Char : '\'' (('\'' | '\\')! | ('\\' ('x' [0-9] [0-9] | 'n' | 't'))) '\'';
+
+@Token
+Comment : '/*' (('*')! | ('*'+ ('*' | '/')!))* '*'+ '/';
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// grammarNFA builds the NFA of the lexer rules of the grammar.
+func grammarNFA(t testing.TB, load func() (*grammar.Grammar, error)) *automata.State {
+	t.Helper()
+	g, err := load()
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	return vocabulary.RulesToNFA(g.LexerRules()...)
+}
+
+var grammars = []struct {
+	name string
+	load func() (*grammar.Grammar, error)
+}{
+	{name: "HarbourCore", load: func() (*grammar.Grammar, error) { return grammar.FromFile("../../examples/HarbourCore.gy") }},
+	{name: "Keywords", load: func() (*grammar.Grammar, error) { return grammar.FromString(keywordsGrammar) }},
+	{name: "Literals", load: func() (*grammar.Grammar, error) { return grammar.FromString(literalsGrammar) }},
+}
+
+// accepted returns the names of the rules accepted by the DFA for the word, or
+// an empty string when the DFA does not accept it.
+func accepted(dfa *automata.State, word []rune) string {
+	state := dfa
+	for _, c := range word {
+		targets := state.Targets(c).Items()
+		if len(targets) == 0 {
+			return ""
+		}
+		state = targets[0]
+	}
+	if !state.Final() {
+		return ""
+	}
+	names := make([]string, 0, state.RulesTypesCount())
+	for _, ruleType := range state.RulesTypes() {
+		names = append(names, ruleType.Name())
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
+
+// randomWords returns words that follow the transitions of the DFA, so many of
+// them are accepted, with some random characters on the way.
+func randomWords(dfa *automata.State, count int) [][]rune {
+	random := rand.New(rand.NewSource(1))
+	words := make([][]rune, 0, count)
+	for range count {
+		word := make([]rune, 0)
+		state := dfa
+		for len(word) < 16 && random.Intn(8) > 0 {
+			intervals := state.Intervals()
+			var c rune
+			if len(intervals) == 0 || random.Intn(10) == 0 {
+				c = rune(random.Intn(0x180))
+			} else {
+				interval := intervals[random.Intn(len(intervals))]
+				c = interval.Start + rune(random.Int63n(int64(min(interval.End-interval.Start, 0xFFFF))+1))
+			}
+			word = append(word, c)
+			targets := state.Targets(c).Items()
+			if len(targets) == 0 {
+				break
+			}
+			state = targets[0]
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+func TestMinimizeKeepsLanguage(t *testing.T) {
+	for _, g := range grammars {
+		t.Run(g.name, func(t *testing.T) {
+			dfa := automata.SubsetDFA(grammarNFA(t, g.load))
+			minimized := automata.MinimizeDFA(automata.SubsetDFA(grammarNFA(t, g.load)))
+			merged := automata.NFAToDFA(grammarNFA(t, g.load))
+			if states, minStates := len(dfa.AllStates()), len(minimized.AllStates()); minStates > states {
+				t.Errorf("got %d states after minimizing, more than the %d before", minStates, states)
+			}
+			acceptedCount := 0
+			for _, word := range randomWords(dfa, 2000) {
+				want := accepted(dfa, word)
+				if want != "" {
+					acceptedCount++
+				}
+				if got := accepted(minimized, word); got != want {
+					t.Errorf("minimized DFA accepts %q as %q, want %q", string(word), got, want)
+				}
+				if got := accepted(merged, word); got != want {
+					t.Errorf("DFA of NFAToDFA accepts %q as %q, want %q", string(word), got, want)
+				}
+			}
+			if acceptedCount == 0 {
+				t.Errorf("no random word accepted")
+			}
+		})
+	}
+}
+
+func TestMinimizeAcceptance(t *testing.T) {
+	tests := []struct {
+		grammar int
+		word    string
+		want    string
+	}{
+		{grammar: 1, word: "func", want: "Ident,stri_function"},
+		{grammar: 1, word: "fun", want: "Ident"},
+		{grammar: 1, word: "endi", want: "Ident,stri_endif"},
+		{grammar: 1, word: "end", want: "Ident,stri_end,stri_enddo,stri_endif"},
+		{grammar: 1, word: "::", want: "str_coloncolon"},
+		{grammar: 1, word: ".5", want: "Number"},
+		{grammar: 1, word: "0x1F", want: "Number"},
+		{grammar: 1, word: "0x", want: ""},
+		{grammar: 1, word: ".and", want: ""},
+		{grammar: 2, word: `"a\"b"`, want: "String"},
+		{grammar: 2, word: `"a`, want: ""},
+		{grammar: 2, word: `'\x41'`, want: "Char"},
+		{grammar: 2, word: "/* a ** b */", want: "Comment"},
+		{grammar: 2, word: "/* a */ */", want: ""},
+	}
+	for _, test := range tests {
+		g := grammars[test.grammar]
+		t.Run(g.name+" "+test.word, func(t *testing.T) {
+			dfa := automata.NFAToDFA(grammarNFA(t, g.load))
+			want := strings.Split(test.want, ",")
+			slices.Sort(want)
+			if got := accepted(dfa, []rune(test.word)); got != strings.Join(want, ",") {
+				t.Errorf("got %q, want %q", got, strings.Join(want, ","))
+			}
+		})
+	}
+}
+
+func BenchmarkNFAToDFA(b *testing.B) {
+	for _, g := range grammars {
+		b.Run(g.name, func(b *testing.B) {
+			nfa := grammarNFA(b, g.load)
+			b.ResetTimer()
+			for range b.N {
+				automata.NFAToDFA(nfa)
+			}
+		})
+	}
+}
+
+func BenchmarkMinimizeDFA(b *testing.B) {
+	for _, g := range grammars {
+		b.Run(g.name, func(b *testing.B) {
+			nfa := grammarNFA(b, g.load)
+			b.ResetTimer()
+			for range b.N {
+				b.StopTimer()
+				dfa := automata.SubsetDFA(nfa)
+				b.StartTimer()
+				automata.MinimizeDFA(dfa)
+			}
+		})
+	}
+}
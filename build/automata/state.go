@@ -1,8 +1,10 @@
 package automata
 
 import (
+	"cmp"
 	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/fabiouggeri/page/util"
 	"golang.org/x/exp/slices"
@@ -11,15 +13,23 @@ import (
 type Symbol = int32
 
 const (
-	EPSILON Symbol = 0 // '\u03B5'
-	ANY     Symbol = 0x7FFFFFFF
+	EPSILON    Symbol = 0 // '\u03B5'
+	MAX_SYMBOL Symbol = unicode.MaxRune
 )
 
+// Interval is the range of symbols from Start to End, both included.
+type Interval struct {
+	Start Symbol
+	End   Symbol
+}
+
+var epsilonInterval = Interval{Start: EPSILON, End: EPSILON}
+
 type State struct {
 	id          int32
 	initial     bool
 	final       bool
-	transitions map[Symbol]*util.Set[*State]
+	transitions map[Interval]*util.Set[*State]
 	rulesTypes  *util.Set[*RuleType]
 }
 
@@ -27,10 +37,50 @@ func NewState(id int32, initial, final bool) *State {
 	return &State{id: id,
 		initial:     initial,
 		final:       final,
-		transitions: make(map[Symbol]*util.Set[*State]),
+		transitions: make(map[Interval]*util.Set[*State]),
 		rulesTypes:  util.NewSet[*RuleType]()}
 }
 
+func (i Interval) Contains(sym Symbol) bool {
+	return sym >= i.Start && sym <= i.End
+}
+
+// SplitIntervals splits the intervals in disjoint intervals covering the same
+// symbols, sorted, so each interval given is the union of some of them.
+func SplitIntervals(intervals []Interval) []Interval {
+	bounds := make([]Symbol, 0, len(intervals)*2)
+	for _, interval := range intervals {
+		bounds = append(bounds, interval.Start, interval.End+1)
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	coverage := make([]int, len(bounds))
+	for _, interval := range intervals {
+		start, _ := slices.BinarySearch(bounds, interval.Start)
+		end, _ := slices.BinarySearch(bounds, interval.End+1)
+		coverage[start]++
+		coverage[end]--
+	}
+	split := make([]Interval, 0, len(bounds))
+	covered := 0
+	for i := 0; i < len(bounds)-1; i++ {
+		covered += coverage[i]
+		if covered > 0 {
+			split = append(split, Interval{Start: bounds[i], End: bounds[i+1] - 1})
+		}
+	}
+	return split
+}
+
+// FirstInterval returns the index of the first of the sorted intervals that
+// does not start before the symbol.
+func FirstInterval(intervals []Interval, sym Symbol) int {
+	index, _ := slices.BinarySearchFunc(intervals, sym, func(interval Interval, sym Symbol) int {
+		return cmp.Compare(interval.Start, sym)
+	})
+	return index
+}
+
 func (s *State) Id() int32 {
 	return s.id
 }
@@ -52,21 +102,25 @@ func (s *State) SetFinal(f bool) {
 }
 
 func (s *State) AddTransitions(sym Symbol, target ...*State) *State {
-	set, found := s.transitions[sym]
+	return s.AddIntervalTransitions(Interval{Start: sym, End: sym}, target...)
+}
+
+func (s *State) AddIntervalTransitions(interval Interval, target ...*State) *State {
+	set, found := s.transitions[interval]
 	if !found {
 		set = util.NewSet[*State]()
-		s.transitions[sym] = set
+		s.transitions[interval] = set
 	}
 	set.AddAll(target...)
 	return s
 }
 
-func (s *State) SetTransitions(transitions map[Symbol]*util.Set[*State]) *State {
+func (s *State) SetTransitions(transitions map[Interval]*util.Set[*State]) *State {
 	s.transitions = transitions
 	return s
 }
 
-func (s *State) visitState(visited map[int32]bool, doThis func(state *State) bool, isMove func(souce *State, sym Symbol, target *State) bool) bool {
+func (s *State) visitState(visited map[int32]bool, doThis func(state *State) bool, isMove func(souce *State, interval Interval, target *State) bool) bool {
 	_, found := visited[s.id]
 	if found {
 		return true
@@ -75,9 +129,9 @@ func (s *State) visitState(visited map[int32]bool, doThis func(state *State) boo
 	if !doThis(s) {
 		return false
 	}
-	for char, transition := range s.transitions {
+	for interval, transition := range s.transitions {
 		for _, targetState := range transition.Items() {
-			if isMove(s, char, targetState) && !targetState.visitState(visited, doThis, isMove) {
+			if isMove(s, interval, targetState) && !targetState.visitState(visited, doThis, isMove) {
 				return false
 			}
 		}
@@ -85,7 +139,7 @@ func (s *State) visitState(visited map[int32]bool, doThis func(state *State) boo
 	return true
 }
 
-func (s *State) WalkThrough(doThis func(state *State) bool, isMove func(souce *State, sym Symbol, target *State) bool) {
+func (s *State) WalkThrough(doThis func(state *State) bool, isMove func(souce *State, interval Interval, target *State) bool) {
 	visited := make(map[int32]bool)
 	s.visitState(visited, doThis, isMove)
 }
@@ -98,7 +152,7 @@ func (s *State) FinalStates() []*State {
 		}
 		return true
 	},
-		func(souce *State, sym Symbol, target *State) bool {
+		func(souce *State, interval Interval, target *State) bool {
 			return true
 		})
 	return finalStates
@@ -125,7 +179,7 @@ func (s *State) RulesTypesCount() int {
 	return s.rulesTypes.Length()
 }
 
-func (s *State) Transitions() map[Symbol]*util.Set[*State] {
+func (s *State) Transitions() map[Interval]*util.Set[*State] {
 	return s.transitions
 }
 
@@ -135,42 +189,29 @@ func (s *State) transitionsToDot(visited map[int32]bool, writer util.TextWriter)
 		return
 	}
 	visited[s.id] = true
-	targets := make(map[*State][]rune)
-	for sym, transition := range s.transitions {
+	targets := make(map[*State][]Interval)
+	for interval, transition := range s.transitions {
 		for _, target := range transition.Items() {
-			_, found := targets[target]
-			if !found {
-				targets[target] = make([]rune, 0)
-			}
-			targets[target] = append(targets[target], sym)
+			targets[target] = append(targets[target], interval)
 		}
 	}
 	for target, label := range targets {
-		writer.WriteF("%d -> %d [label=\"%s\"]", s.id, target.id, symbolsToLabel(label)).NewLine()
+		writer.WriteF("%d -> %d [label=\"%s\"]", s.id, target.id, intervalsToLabel(label)).NewLine()
 		target.transitionsToDot(visited, writer)
 	}
 }
 
-func symbolsToLabel(symbols []rune) string {
+func intervalsToLabel(intervals []Interval) string {
 	str := &strings.Builder{}
-	slices.SortFunc(symbols, func(a, b rune) int { return int(a - b) })
-	if slices.Index(symbols, ANY) >= 0 {
-		lastChar := rune(0)
-		str.WriteString("[^")
-		for _, c := range symbols {
-			if c > lastChar+1 && c != ANY {
-				for r := lastChar + 1; r < c; r++ {
-					charToLabel(str, r)
-				}
+	slices.SortFunc(intervals, func(a, b Interval) int { return cmp.Compare(a.Start, b.Start) })
+	for _, interval := range intervals {
+		charToLabel(str, interval.Start)
+		if interval.End > interval.Start {
+			if interval.End > interval.Start+1 {
+				str.WriteRune('-')
 			}
-			lastChar = c
+			charToLabel(str, interval.End)
 		}
-		str.WriteRune(']')
-	} else {
-		for _, c := range symbols {
-			charToLabel(str, c)
-		}
-
 	}
 	return str.String()
 }
@@ -191,7 +232,7 @@ func charToLabel(str *strings.Builder, c rune) {
 		str.WriteString("\\\\")
 	case EPSILON:
 		str.WriteRune('€')
-	case ANY:
+	case MAX_SYMBOL:
 		str.WriteString("...")
 	default:
 		if c < 32 {
@@ -243,38 +284,48 @@ func (s *State) AllStates() []*State {
 		states = append(states, state)
 		return true
 	},
-		func(souce *State, sym Symbol, target *State) bool {
+		func(souce *State, interval Interval, target *State) bool {
 			return true
 		})
 	return states
 }
 
-func (s *State) Symbols() []Symbol {
-	symbols := make([]Symbol, 0)
-	for symbol := range s.transitions {
-		symbols = append(symbols, symbol)
+// Intervals returns the intervals of the transitions of the state, sorted.
+func (s *State) Intervals() []Interval {
+	intervals := make([]Interval, 0, len(s.transitions))
+	for interval := range s.transitions {
+		if interval != epsilonInterval {
+			intervals = append(intervals, interval)
+		}
 	}
-	return symbols
+	slices.SortFunc(intervals, func(a, b Interval) int {
+		if a.Start != b.Start {
+			return cmp.Compare(a.Start, b.Start)
+		}
+		return cmp.Compare(a.End, b.End)
+	})
+	return intervals
 }
 
-func (s *State) AllSymbols() []Symbol {
-	symbols := make(map[Symbol]bool, 256)
+// AllIntervals returns the distinct intervals of the transitions of the automaton.
+func (s *State) AllIntervals() []Interval {
+	intervals := make(map[Interval]bool, 256)
 	s.WalkThrough(
 		func(state *State) bool {
 			return true
 		},
-		func(souce *State, sym Symbol, target *State) bool {
-			if sym != EPSILON {
-				symbols[sym] = true
+		func(souce *State, interval Interval, target *State) bool {
+			if interval != epsilonInterval {
+				intervals[interval] = true
 			}
 			return true
 		},
 	)
-	allSymbols := make([]Symbol, 0, len(symbols))
-	for key := range symbols {
-		allSymbols = append(allSymbols, key)
+	allIntervals := make([]Interval, 0, len(intervals))
+	for key := range intervals {
+		allIntervals = append(allIntervals, key)
 	}
-	return allSymbols
+	return allIntervals
 }
 
 func (s *State) EpsilonClosures() *util.Set[*State] {
@@ -284,21 +335,20 @@ func (s *State) EpsilonClosures() *util.Set[*State] {
 			states.Add(state)
 			return true
 		},
-		func(souce *State, sym Symbol, target *State) bool {
-			return sym == EPSILON
+		func(souce *State, interval Interval, target *State) bool {
+			return interval == epsilonInterval
 		},
 	)
 	return states
 }
 
 func (s *State) symbolTargets(sym Symbol, symbolTargets *util.Set[*State]) {
-	targets, found := s.transitions[sym]
-	if found {
-		for _, s := range targets.Items() {
-			symbolTargets.Add(s)
+	for interval, targets := range s.transitions {
+		if interval != epsilonInterval && interval.Contains(sym) {
+			symbolTargets.AddAll(targets.Items()...)
 		}
 	}
-	targets, found = s.transitions[EPSILON]
+	targets, found := s.transitions[epsilonInterval]
 	if found {
 		for _, epsilonTarget := range targets.Items() {
 			epsilonTarget.symbolTargets(sym, symbolTargets)
@@ -243,6 +243,20 @@ func (g *Grammar) validateRules() {
 			}
 		}
 	}
+	g.validateModes(lexerRules)
+}
+
+// validateModes checks that the lexer rules push only the modes of some lexer rule.
+func (g *Grammar) validateModes(lexerRules []*rule.NonTerminalRule) {
+	modes := util.NewSet(rule.DEFAULT_MODE)
+	for _, r := range lexerRules {
+		modes.AddAll(r.Modes()...)
+	}
+	for _, r := range lexerRules {
+		if mode, found := r.GetOption(rule.PUSH_MODE); found && !modes.Contains(strings.TrimSpace(mode)) {
+			g.errors = append(g.errors, fmt.Errorf("lexer rule '%s' pushes the undefined mode '%s'", r.Id(), strings.TrimSpace(mode)))
+		}
+	}
 }
 
 func (g *Grammar) parserRulesReferences(r *rule.NonTerminalRule) []*rule.NonTerminalRule {
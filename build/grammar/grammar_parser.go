@@ -237,8 +237,8 @@ func (l *grammarParser) charsetEntry(importing bool) error {
 
 func (l *grammarParser) nonTerminalEntry(ruleName string, importing bool) error {
 
-	if ruleName == "EOI" {
-		return l.error("EOI is a reserved rule name.")
+	if ruleName == "EOI" || ruleName == "ERROR" {
+		return l.error("%s is a reserved rule name.", ruleName)
 	}
 
 	currentRule := l.grammar.GetRule(ruleName)
@@ -2,6 +2,7 @@ package rule
 
 import (
 	"maps"
+	"strings"
 
 	"github.com/fabiouggeri/page/util"
 )
@@ -70,6 +71,31 @@ func (r *NonTerminalRule) GetOption(option *RuleOption) (string, bool) {
 	return value, found
 }
 
+// Modes returns the lexer modes where the lexer rule is active, given by the
+// Mode option as a list separated by commas.
+func (r *NonTerminalRule) Modes() []string {
+	value, found := r.options[MODE]
+	if !found {
+		return []string{DEFAULT_MODE}
+	}
+	modes := make([]string, 0)
+	for _, mode := range strings.Split(value, ",") {
+		if mode = strings.TrimSpace(mode); mode != "" {
+			modes = append(modes, mode)
+		}
+	}
+	return modes
+}
+
+// Channel returns the token channel of the lexer rule, given by the Channel option.
+func (r *NonTerminalRule) Channel() string {
+	value, found := r.options[CHANNEL]
+	if !found || strings.TrimSpace(value) == "" {
+		return DEFAULT_CHANNEL
+	}
+	return strings.TrimSpace(value)
+}
+
 func (r *NonTerminalRule) Options() []*RuleOption {
 	options := make([]*RuleOption, 0, len(r.options))
 	for k := range r.options {
@@ -18,8 +18,20 @@ var (
 	IGNORE       *RuleOption = &RuleOption{code: 0x0100, name: "Ignore", parameterized: false, mandatory: false}
 	START_LINE   *RuleOption = &RuleOption{code: 0x0200, name: "StartLine", parameterized: false, mandatory: false}
 	ONLY_IGNORED *RuleOption = &RuleOption{code: 0x0400, name: "OnlyIgnoredInLine", parameterized: false, mandatory: false}
+	MODE         *RuleOption = &RuleOption{code: 0x0800, name: "Mode", parameterized: true, mandatory: true}
+	PUSH_MODE    *RuleOption = &RuleOption{code: 0x1000, name: "PushMode", parameterized: true, mandatory: true}
+	POP_MODE     *RuleOption = &RuleOption{code: 0x2000, name: "PopMode", parameterized: false, mandatory: false}
+	CHANNEL      *RuleOption = &RuleOption{code: 0x4000, name: "Channel", parameterized: true, mandatory: true}
 )
 
+// DEFAULT_MODE is the lexer mode of the lexer rules without the Mode option,
+// where the lexer starts.
+const DEFAULT_MODE = "DEFAULT"
+
+// DEFAULT_CHANNEL is the token channel of the lexer rules without the Channel
+// option. The parser only sees the tokens of the default channel.
+const DEFAULT_CHANNEL = "DEFAULT"
+
 var AllOptions = []*RuleOption{
 	MAIN,
 	TOKEN,
@@ -31,6 +43,10 @@ var AllOptions = []*RuleOption{
 	IGNORE,
 	START_LINE,
 	ONLY_IGNORED,
+	MODE,
+	PUSH_MODE,
+	POP_MODE,
+	CHANNEL,
 }
 
 func (o *RuleOption) Code() int {
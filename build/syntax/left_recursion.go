@@ -0,0 +1,119 @@
+package syntax
+
+import (
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// leftRecursion finds the rules that can call themselves before consuming any
+// token. The rules called at the start position of a rule form a graph and each
+// strongly connected component of this graph is a set of mutually left recursive rules.
+type leftRecursion struct {
+	syntax     *parser.Syntax
+	nullable   []bool
+	leftCalls  [][]int
+	index      []int
+	lowLink    []int
+	onStack    []bool
+	stack      []int
+	nextIndex  int
+	components [][]int
+}
+
+func computeLeftRecursion(s *parser.Syntax) *leftRecursion {
+	lr := &leftRecursion{
+		syntax:     s,
+		nullable:   computeNullable(s),
+		leftCalls:  make([][]int, s.RulesCount()),
+		index:      make([]int, s.RulesCount()),
+		lowLink:    make([]int, s.RulesCount()),
+		onStack:    make([]bool, s.RulesCount()),
+		stack:      make([]int, 0),
+		components: make([][]int, s.RulesCount()),
+	}
+	lr.computeLeftCalls()
+	for ruleId := range lr.index {
+		lr.index[ruleId] = -1
+	}
+	for ruleId := range lr.index {
+		if lr.index[ruleId] < 0 {
+			lr.connect(ruleId)
+		}
+	}
+	return lr
+}
+
+func (lr *leftRecursion) computeLeftCalls() {
+	for ruleId := range lr.leftCalls {
+		rules := lr.syntax.Subrules(ruleId)
+		switch parser.ParserRuleType(rules[0]) {
+		case parser.AND_RULE:
+			calls := make([]int, 0, len(rules)-1)
+			for _, sub := range rules[1:] {
+				calls = append(calls, sub)
+				if !lr.nullable[sub] {
+					break
+				}
+			}
+			lr.leftCalls[ruleId] = calls
+		case parser.OR_RULE:
+			lr.leftCalls[ruleId] = rules[1:]
+		case parser.TERMINAL_RULE:
+			lr.leftCalls[ruleId] = []int{}
+		default:
+			lr.leftCalls[ruleId] = rules[1:2]
+		}
+	}
+}
+
+// connect is the Tarjan's strongly connected components algorithm
+func (lr *leftRecursion) connect(ruleId int) {
+	lr.index[ruleId] = lr.nextIndex
+	lr.lowLink[ruleId] = lr.nextIndex
+	lr.nextIndex++
+	lr.stack = append(lr.stack, ruleId)
+	lr.onStack[ruleId] = true
+	for _, called := range lr.leftCalls[ruleId] {
+		if lr.index[called] < 0 {
+			lr.connect(called)
+			lr.lowLink[ruleId] = min(lr.lowLink[ruleId], lr.lowLink[called])
+		} else if lr.onStack[called] {
+			lr.lowLink[ruleId] = min(lr.lowLink[ruleId], lr.index[called])
+		}
+	}
+	if lr.lowLink[ruleId] != lr.index[ruleId] {
+		return
+	}
+	component := make([]int, 0)
+	for {
+		last := lr.stack[len(lr.stack)-1]
+		lr.stack = lr.stack[:len(lr.stack)-1]
+		lr.onStack[last] = false
+		component = append(component, last)
+		if last == ruleId {
+			break
+		}
+	}
+	if len(component) == 1 && !lr.callsItself(ruleId) {
+		return
+	}
+	for _, member := range component {
+		lr.components[member] = component
+	}
+}
+
+func (lr *leftRecursion) callsItself(ruleId int) bool {
+	for _, called := range lr.leftCalls[ruleId] {
+		if called == ruleId {
+			return true
+		}
+	}
+	return false
+}
+
+func (lr *leftRecursion) isLeftRecursive(ruleId int) bool {
+	return lr.components[ruleId] != nil
+}
+
+func (lr *leftRecursion) involved(ruleId int) []int {
+	return lr.components[ruleId]
+}
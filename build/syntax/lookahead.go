@@ -0,0 +1,85 @@
+package syntax
+
+import (
+	"github.com/fabiouggeri/page/build/rule"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// computeLookahead returns, for each rule of the syntax, the token types that can
+// start a match of the rule, in the order the rule tries them. It is nil when the
+// rule can match without consuming tokens or can start with an ignored token,
+// because the next token is not enough to know that the rule fails.
+func computeLookahead(s *parser.Syntax, v *lexer.Vocabulary) [][]int {
+	nullable := computeNullable(s)
+	lookahead := make([][]int, s.RulesCount())
+	changed := true
+	for changed {
+		changed = false
+		for ruleId := range lookahead {
+			tokenTypes := startTokenTypes(lookahead, nullable, s.Subrules(ruleId))
+			if len(tokenTypes) != len(lookahead[ruleId]) {
+				lookahead[ruleId] = tokenTypes
+				changed = true
+			}
+		}
+	}
+	for ruleId, tokenTypes := range lookahead {
+		if nullable[ruleId] || len(tokenTypes) == 0 || hasIgnored(v, tokenTypes) {
+			lookahead[ruleId] = nil
+		}
+	}
+	return lookahead
+}
+
+func startTokenTypes(lookahead [][]int, nullable []bool, rules []int) []int {
+	tokenTypes := make([]int, 0)
+	switch parser.ParserRuleType(rules[0]) {
+	case parser.AND_RULE:
+		for _, sub := range rules[1:] {
+			tokenTypes = appendTokenTypes(tokenTypes, lookahead[sub])
+			if !nullable[sub] {
+				break
+			}
+		}
+	case parser.OR_RULE:
+		for _, sub := range rules[1:] {
+			tokenTypes = appendTokenTypes(tokenTypes, lookahead[sub])
+		}
+	case parser.ONE_OR_MORE_RULE,
+		parser.ZERO_OR_MORE_RULE,
+		parser.OPTIONAL_RULE,
+		parser.NON_TERMINAL_RULE:
+		tokenTypes = appendTokenTypes(tokenTypes, lookahead[rules[1]])
+	case parser.TERMINAL_RULE:
+		tokenTypes = append(tokenTypes, rules[1])
+	default:
+		// predicates do not consume tokens
+	}
+	return tokenTypes
+}
+
+func appendTokenTypes(tokenTypes []int, newTypes []int) []int {
+	for _, newType := range newTypes {
+		found := false
+		for _, tokenType := range tokenTypes {
+			if tokenType == newType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tokenTypes = append(tokenTypes, newType)
+		}
+	}
+	return tokenTypes
+}
+
+func hasIgnored(v *lexer.Vocabulary, tokenTypes []int) bool {
+	for _, tokenType := range tokenTypes {
+		if v.HasOption(tokenType, rule.IGNORE) {
+			return true
+		}
+	}
+	return false
+}
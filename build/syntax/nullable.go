@@ -0,0 +1,50 @@
+package syntax
+
+import (
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// computeNullable returns, for each rule of the syntax, if the rule can match without consuming tokens.
+func computeNullable(s *parser.Syntax) []bool {
+	nullable := make([]bool, s.RulesCount())
+	changed := true
+	for changed {
+		changed = false
+		for ruleId := range nullable {
+			if !nullable[ruleId] && isNullable(nullable, s.Subrules(ruleId)) {
+				nullable[ruleId] = true
+				changed = true
+			}
+		}
+	}
+	return nullable
+}
+
+func isNullable(nullable []bool, rules []int) bool {
+	switch parser.ParserRuleType(rules[0]) {
+	case parser.AND_RULE:
+		for _, sub := range rules[1:] {
+			if !nullable[sub] {
+				return false
+			}
+		}
+		return true
+	case parser.OR_RULE:
+		for _, sub := range rules[1:] {
+			if nullable[sub] {
+				return true
+			}
+		}
+		return false
+	case parser.ZERO_OR_MORE_RULE,
+		parser.OPTIONAL_RULE,
+		parser.TEST_RULE,
+		parser.TEST_NOT_RULE:
+		return true
+	case parser.ONE_OR_MORE_RULE,
+		parser.NON_TERMINAL_RULE:
+		return nullable[rules[1]]
+	default:
+		return false
+	}
+}
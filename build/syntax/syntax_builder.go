@@ -63,10 +63,57 @@ func (b *syntaxBuilder) build(g *grammar.Grammar) {
 		b.syntax.SetFirst(parserRule.id, b.firstRulesToId(parserRule.firstRules))
 		b.syntax.SetFollow(parserRule.id, b.followRulesToId(parserRule.followRules))
 		b.setOptions(parserRule)
+		b.setLabel(parserRule)
 		if b.isMainRule(g, parserRule.name) {
 			b.syntax.SetStartRule(parserRule.id)
 		}
 	}
+	b.setLeftRecursion()
+	b.setElementsFollow()
+	b.setLookahead()
+}
+
+func (b *syntaxBuilder) setLookahead() {
+	for ruleId, tokenTypes := range computeLookahead(b.syntax, b.vocabulary) {
+		b.syntax.SetLookahead(ruleId, tokenTypes)
+	}
+}
+
+// setElementsFollow completes the follow tables of the sequences with the
+// elements that are not grammar rules, like groups and repetitions.
+func (b *syntaxBuilder) setElementsFollow() {
+	nullable := computeNullable(b.syntax)
+	for ruleId := 0; ruleId < b.syntax.RulesCount(); ruleId++ {
+		rules := b.syntax.Subrules(ruleId)
+		if parser.ParserRuleType(rules[0]) != parser.AND_RULE {
+			continue
+		}
+		for i, element := range rules[1 : len(rules)-1] {
+			if b.syntax.Follow(ruleId, element) != nil {
+				continue
+			}
+			followIds := util.NewSet[int]()
+			for _, next := range rules[i+2:] {
+				followIds.AddAll(b.syntax.First(next)...)
+				if !nullable[next] {
+					break
+				}
+			}
+			if !followIds.Empty() {
+				b.syntax.AddFollow(ruleId, parser.NewRuleFollow(element, followIds.Items()))
+			}
+		}
+	}
+}
+
+func (b *syntaxBuilder) setLeftRecursion() {
+	lr := computeLeftRecursion(b.syntax)
+	for ruleId := 0; ruleId <= b.lastGrammarRuleId; ruleId++ {
+		if lr.isLeftRecursive(ruleId) {
+			b.syntax.SetOption(ruleId, parser.LEFT_RECURSIVE)
+			b.syntax.SetInvolved(ruleId, lr.involved(ruleId))
+		}
+	}
 }
 
 func (b *syntaxBuilder) followRulesToId(rules map[*rule.NonTerminalRule]*util.Set[*rule.NonTerminalRule]) []parser.RuleFollow {
@@ -161,6 +208,15 @@ func (b *syntaxBuilder) setOptions(v *parserRule) {
 	}
 }
 
+func (b *syntaxBuilder) setLabel(v *parserRule) {
+	if !v.lexer {
+		return
+	}
+	if terminal, ok := v.rule.Rule().(rule.TerminalRule); ok {
+		b.syntax.SetLabel(v.id, terminal.String())
+	}
+}
+
 func (b *syntaxBuilder) isMainRule(g *grammar.Grammar, k string) bool {
 	mainRule := g.GetRule(k)
 	return mainRule != nil && mainRule.Id() == g.MainRule().Id()
@@ -13,18 +13,15 @@ type nfaVisitor struct {
 	states     *util.Deque[*automata.State]
 	nextRuleId uint16
 	rulesTypes map[string]*automata.RuleType
-	maxSymbol  rune
 }
 
 var _ rule.RuleVisitor = &nfaVisitor{}
 
 func RulesToNFA(rules ...*rule.NonTerminalRule) *automata.State {
-	maxSymbol := rulesMaxSymbol(rules...)
 	v := &nfaVisitor{nextId: 0,
 		states:     util.NewDeque[*automata.State](),
 		nextRuleId: 0,
 		rulesTypes: make(map[string]*automata.RuleType),
-		maxSymbol:  maxSymbol,
 	}
 	s1 := v.newInitialState()
 	for _, r := range rules {
@@ -41,14 +38,6 @@ func RulesToNFA(rules ...*rule.NonTerminalRule) *automata.State {
 	return s1
 }
 
-func rulesMaxSymbol(rules ...*rule.NonTerminalRule) rune {
-	ms := newMaxSymbolVisitor()
-	for _, r := range rules {
-		r.Visit(ms)
-	}
-	return ms.maxSymbol
-}
-
 func (n *nfaVisitor) newInitialState() *automata.State {
 	s := automata.NewState(n.nextId, true, false)
 	n.nextId++
@@ -120,9 +109,7 @@ func (n *nfaVisitor) VisitOrRule(visitedRule *rule.OrRule) {
 			case *rule.CharRule:
 				addCharTransitions(castRule, s1, s2)
 			case *rule.RangeRule:
-				for c := castRule.Start(); c <= castRule.End(); c++ {
-					s1.AddTransitions(c, s2)
-				}
+				s1.AddIntervalTransitions(automata.Interval{Start: castRule.Start(), End: castRule.End()}, s2)
 			default:
 				// do nothing
 			}
@@ -221,9 +208,7 @@ func (n *nfaVisitor) VisitOptionalRule(rule *rule.OptionalRule) {
 func (n *nfaVisitor) VisitRangeRule(rule *rule.RangeRule) {
 	s1 := n.newInitialState()
 	s2 := n.newFinalState()
-	for c := rule.Start(); c <= rule.End(); c++ {
-		s1.AddTransitions(c, s2)
-	}
+	s1.AddIntervalTransitions(automata.Interval{Start: rule.Start(), End: rule.End()}, s2)
 	n.push(s1)
 }
 
@@ -279,19 +264,10 @@ func (n *nfaVisitor) VisitNotRule(rule *rule.NotRule) {
 }
 
 func (n *nfaVisitor) negateTransitions(state *automata.State) {
-	transitions := state.Transitions()
-	targetsMap := make(map[*automata.State]*util.Set[automata.Symbol])
-	for sym, targets := range transitions {
-		if sym != automata.EPSILON {
-			symTargets := targets.Items()
-			for _, target := range symTargets {
-				allSymbols, found := targetsMap[target]
-				if found {
-					allSymbols.Add(sym)
-				} else {
-					targetsMap[target] = util.NewSet(sym)
-				}
-			}
+	targetsMap := make(map[*automata.State][]automata.Interval)
+	for _, interval := range state.Intervals() {
+		for _, target := range state.Transitions()[interval].Items() {
+			targetsMap[target] = append(targetsMap[target], interval)
 		}
 	}
 	if len(targetsMap) > 0 {
@@ -299,28 +275,28 @@ func (n *nfaVisitor) negateTransitions(state *automata.State) {
 	}
 }
 
-func (n *nfaVisitor) targetsMapToTransitions(targetsMap map[*automata.State]*util.Set[automata.Symbol]) map[automata.Symbol]*util.Set[*automata.State] {
-	newTransitions := make(map[automata.Symbol]*util.Set[*automata.State])
-	for target, symbols := range targetsMap {
-		for i := automata.Symbol(1); i <= n.maxSymbol; i++ {
-			if !symbols.Contains(i) {
-				symTargets, found := newTransitions[i]
-				if found {
-					symTargets.Add(target)
-				} else {
-					newTransitions[i] = util.NewSet(target)
-				}
-			}
-		}
-		if !symbols.Contains(automata.ANY) {
-			symTargets, found := newTransitions[automata.ANY]
-			if found {
+// targetsMapToTransitions creates transitions to each target on the symbols not
+// in the sorted intervals of the target.
+func (n *nfaVisitor) targetsMapToTransitions(targetsMap map[*automata.State][]automata.Interval) map[automata.Interval]*util.Set[*automata.State] {
+	newTransitions := make(map[automata.Interval]*util.Set[*automata.State])
+	addTransition := func(start, end automata.Symbol, target *automata.State) {
+		if start <= end {
+			interval := automata.Interval{Start: start, End: end}
+			if symTargets, found := newTransitions[interval]; found {
 				symTargets.Add(target)
 			} else {
-				newTransitions[automata.ANY] = util.NewSet(target)
+				newTransitions[interval] = util.NewSet(target)
 			}
 		}
 	}
+	for target, intervals := range targetsMap {
+		next := automata.Symbol(1)
+		for _, interval := range intervals {
+			addTransition(next, interval.Start-1, target)
+			next = max(next, interval.End+1)
+		}
+		addTransition(next, automata.MAX_SYMBOL, target)
+	}
 	return newTransitions
 }
 
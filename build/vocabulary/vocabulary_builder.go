@@ -1,6 +1,9 @@
 package vocabulary
 
 import (
+	"slices"
+	"strings"
+
 	"github.com/fabiouggeri/page/build/automata"
 	"github.com/fabiouggeri/page/build/grammar"
 	"github.com/fabiouggeri/page/build/rule"
@@ -9,40 +12,73 @@ import (
 )
 
 type vocabularyBuilder struct {
-	maxSymbol     rune
+	intervals     []automata.Interval
+	classes       []int
+	classesCount  int
 	tokensTypes   *util.Set[string]
 	tokensOptions map[string]*util.Set[*rule.RuleOption]
 	tokensMap     map[string]int
-	dfa           *automata.State
+	pushModes     map[string]string
+	channels      map[string]string
+	modes         []string
+	dfas          []*automata.State
 }
 
+// FromGrammar builds the vocabulary with one automaton for each lexer mode. The
+// lexer rules without the Mode option belong to the default mode.
 func FromGrammar(grammar *grammar.Grammar) *runtime.Vocabulary {
-	rules := grammar.LexerRules()
-	return FromDFA(automata.NFAToDFA(RulesToNFA(rules...)))
+	modesRules := make(map[string][]*rule.NonTerminalRule)
+	for _, r := range grammar.LexerRules() {
+		for _, mode := range r.Modes() {
+			modesRules[mode] = append(modesRules[mode], r)
+		}
+	}
+	modes := make([]string, 0, len(modesRules))
+	for mode := range modesRules {
+		if mode != rule.DEFAULT_MODE {
+			modes = append(modes, mode)
+		}
+	}
+	slices.Sort(modes)
+	modes = slices.Insert(modes, 0, rule.DEFAULT_MODE)
+	dfas := make([]*automata.State, 0, len(modes))
+	for _, mode := range modes {
+		dfas = append(dfas, automata.NFAToDFA(RulesToNFA(modesRules[mode]...)))
+	}
+	return newVocabularyBuilder(modes, dfas).build()
 }
 
 func FromDFA(dfa *automata.State) *runtime.Vocabulary {
-	vb := &vocabularyBuilder{
-		maxSymbol:     rune(0),
+	return newVocabularyBuilder([]string{rule.DEFAULT_MODE}, []*automata.State{dfa}).build()
+}
+
+func newVocabularyBuilder(modes []string, dfas []*automata.State) *vocabularyBuilder {
+	return &vocabularyBuilder{
+		intervals:     []automata.Interval{{Start: 0, End: automata.MAX_SYMBOL}},
 		tokensTypes:   util.NewSet[string](),
 		tokensOptions: make(map[string]*util.Set[*rule.RuleOption]),
 		tokensMap:     make(map[string]int),
-		dfa:           dfa,
+		pushModes:     make(map[string]string),
+		channels:      make(map[string]string),
+		modes:         modes,
+		dfas:          dfas,
 	}
-	return vb.build()
 }
 
 func (vb *vocabularyBuilder) build() *runtime.Vocabulary {
-	vb.dfa.WalkThrough(vb.visitState, func(souce *automata.State, char rune, target *automata.State) bool { return true })
+	for _, dfa := range vb.dfas {
+		dfa.WalkThrough(vb.visitState, func(souce *automata.State, interval automata.Interval, target *automata.State) bool { return true })
+	}
+	vb.buildSymbolsClasses()
 	tokenId := 1
 	tokensTypes := vb.tokensTypes.Items()
-	tokensNames := make([]string, 0, len(tokensTypes)+1)
+	tokensNames := make([]string, 0, len(tokensTypes)+2)
 	tokensOptions := make([]int, 0, cap(tokensNames))
 	tokensNames = append(tokensNames, "EOI")
 	tokensOptions = append(tokensOptions, 0)
-	vb.tokensMap["EOI"] = 0
+	vb.tokensMap["EOI"] = runtime.TKN_EOF
 	for _, tokenType := range tokensTypes {
-		if tokenType != "EOI" {
+		if tokenType != "EOI" && tokenType != "ERROR" {
 			tokensNames = append(tokensNames, tokenType)
 			optionsSet := 0
 			if options, found := vb.tokensOptions[tokenType]; found {
@@ -55,22 +91,107 @@ func (vb *vocabularyBuilder) build() *runtime.Vocabulary {
 			tokenId++
 		}
 	}
-	return runtime.NewVocabulary(tokensNames, tokensOptions, vb.buildTransitionTable(), vb.buildTokensTable())
+	// the error type comes after the tokens of the grammar, so their types do not
+	// depend on it, and is ignored, so the parser skips the error tokens
+	tokensNames = append(tokensNames, "ERROR")
+	tokensOptions = append(tokensOptions, rule.IGNORE.Code())
+	vb.tokensMap["ERROR"] = tokenId
+	symbolsStarts, symbolsClasses := vb.symbolsClassesTable()
+	v := runtime.NewVocabularyWithClasses(tokensNames, tokensOptions, symbolsStarts, symbolsClasses,
+		vb.buildTransitionTable(vb.dfas[0]), vb.buildTokensTable(vb.dfas[0]))
+	for mode := 1; mode < len(vb.modes); mode++ {
+		v.AddMode(vb.modes[mode], vb.buildTransitionTable(vb.dfas[mode]), vb.buildTokensTable(vb.dfas[mode]))
+	}
+	for tokenName, mode := range vb.pushModes {
+		v.SetPushMode(vb.tokenId(tokenName), v.ModeIndex(mode))
+	}
+	channels := util.NewSet[string]()
+	for _, channel := range vb.channels {
+		channels.Add(channel)
+	}
+	channelsNames := channels.Items()
+	slices.Sort(channelsNames)
+	for _, channel := range channelsNames {
+		v.AddChannel(channel)
+	}
+	for tokenName, channel := range vb.channels {
+		v.SetTokenChannel(vb.tokenId(tokenName), v.ChannelIndex(channel))
+	}
+	return v
 }
 
 func (vb *vocabularyBuilder) visitState(state *automata.State) bool {
 	for _, tt := range state.RulesTypes() {
 		vb.tokensTypes.Add(tt.Name())
 		vb.addTokenOptions(tt.Name(), tt.Rule().Options()...)
-	}
-	for _, symbol := range state.Symbols() {
-		if symbol > vb.maxSymbol && symbol != automata.ANY {
-			vb.maxSymbol = symbol
+		if mode, found := tt.Rule().GetOption(rule.PUSH_MODE); found {
+			vb.pushModes[tt.Name()] = strings.TrimSpace(mode)
+		}
+		if channel := tt.Rule().Channel(); channel != rule.DEFAULT_CHANNEL {
+			// the tokens out of the default channel are hidden from the parser
+			vb.channels[tt.Name()] = channel
+			vb.addTokenOptions(tt.Name(), rule.IGNORE)
 		}
 	}
+	vb.intervals = append(vb.intervals, state.Intervals()...)
 	return true
 }
 
+// buildSymbolsClasses splits the symbols in classes of symbols with the same
+// transitions in all the states of all the modes, so the transitions tables
+// have a column for each class instead of one for each symbol. The intervals of
+// the transitions are split in disjoint intervals, all in the same class at
+// first, and each state moves the intervals of a class to new classes by the
+// target of their transitions.
+func (vb *vocabularyBuilder) buildSymbolsClasses() {
+	vb.intervals = automata.SplitIntervals(vb.intervals)
+	classes := make([]int, len(vb.intervals))
+	nextClass := 1
+	for _, dfa := range vb.dfas {
+		for _, state := range dfa.AllStates() {
+			refined := make(map[[2]int]int)
+			for interval, targets := range state.Transitions() {
+				target := int(targets.Items()[0].Id())
+				for i := automata.FirstInterval(vb.intervals, interval.Start); i < len(vb.intervals) && vb.intervals[i].End <= interval.End; i++ {
+					key := [2]int{classes[i], target}
+					class, found := refined[key]
+					if !found {
+						class = nextClass
+						refined[key] = class
+						nextClass++
+					}
+					classes[i] = class
+				}
+			}
+		}
+	}
+	numbers := make(map[int]int)
+	vb.classes = make([]int, len(classes))
+	for i, class := range classes {
+		number, found := numbers[class]
+		if !found {
+			number = len(numbers)
+			numbers[class] = number
+		}
+		vb.classes[i] = number
+	}
+	vb.classesCount = len(numbers)
+}
+
+// symbolsClassesTable returns the starts of the intervals of symbols of the
+// same class, joining the adjacent ones, and their classes.
+func (vb *vocabularyBuilder) symbolsClassesTable() ([]rune, []int) {
+	starts := make([]rune, 0, len(vb.intervals))
+	classes := make([]int, 0, len(vb.intervals))
+	for i, interval := range vb.intervals {
+		if i == 0 || vb.classes[i] != vb.classes[i-1] {
+			starts = append(starts, interval.Start)
+			classes = append(classes, vb.classes[i])
+		}
+	}
+	return starts, classes
+}
+
 func (vb *vocabularyBuilder) addTokenOptions(tokenName string, optionsToSet ...*rule.RuleOption) {
 	options, found := vb.tokensOptions[tokenName]
 	if !found {
@@ -80,17 +201,15 @@ func (vb *vocabularyBuilder) addTokenOptions(tokenName string, optionsToSet ...*
 	options.AddAll(optionsToSet...)
 }
 
-func (vb *vocabularyBuilder) buildTransitionTable() [][]int {
-	states := vb.dfa.AllStates()
+func (vb *vocabularyBuilder) buildTransitionTable(dfa *automata.State) [][]int {
+	states := dfa.AllStates()
 	transitionTable := make([][]int, len(states))
 	for _, s := range states {
-		entry := createTransitionsTableEntry(int(vb.maxSymbol) + 1)
-		for symbol, targets := range s.Transitions() {
+		entry := createTransitionsTableEntry(vb.classesCount)
+		for interval, targets := range s.Transitions() {
 			items := targets.Items()
-			if symbol != automata.ANY {
-				entry[int(symbol)] = int(items[0].Id()) // DFA must have only one target for each symbol
-			} else {
-				entry[0] = int(items[0].Id()) // DFA must have only one target for each symbol
+			for i := automata.FirstInterval(vb.intervals, interval.Start); i < len(vb.intervals) && vb.intervals[i].End <= interval.End; i++ {
+				entry[vb.classes[i]] = int(items[0].Id()) // DFA must have only one target for each symbol
 			}
 		}
 		transitionTable[s.Id()] = entry
@@ -106,8 +225,8 @@ func createTransitionsTableEntry(size int) []int {
 	return a
 }
 
-func (vb *vocabularyBuilder) buildTokensTable() [][]int {
-	states := vb.dfa.AllStates()
+func (vb *vocabularyBuilder) buildTokensTable(dfa *automata.State) [][]int {
+	states := dfa.AllStates()
 	tokensTable := make([][]int, len(states))
 	for _, s := range states {
 		tokenTypes := s.RulesTypes()
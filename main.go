@@ -184,15 +184,19 @@ func testLexer() {
 		//printTree(ast, i, s, 0)
 		saveAST(rootNode, p, 0)
 		nodeVisitor := visitor.New(syntax)
-		nodeVisitor.EnterRuleName("AnyStatement", func(parser *parser.Parser, node *parser.ASTNode) {
+		nodeVisitor.EnterRuleName("AnyStatement", func(parser *parser.Parser, node *parser.ASTNode) (visitor.Action, error) {
 			row, col := parser.Position(node)
 			fmt.Printf("Enter(%d, %d): %s\n", row, col, parser.NodeText(node))
+			return visitor.CONTINUE, nil
 		})
-		nodeVisitor.ExitRuleName("AnyStatement", func(parser *parser.Parser, node *parser.ASTNode) {
+		nodeVisitor.ExitRuleName("AnyStatement", func(parser *parser.Parser, node *parser.ASTNode) (visitor.Action, error) {
 			row, col := parser.Position(node)
 			fmt.Printf("Exit(%d, %d): %s\n", row, col, parser.NodeText(node))
+			return visitor.CONTINUE, nil
 		})
-		visitor.NewWalker(p, nodeVisitor).Walk(rootNode)
+		if err := visitor.NewWalker(p, nodeVisitor).Walk(rootNode); err != nil {
+			fmt.Printf("Walk error: %s\n", err)
+		}
 		node := rootNode.Find(syntax, "Statement/IncludeDirective")
 		fmt.Printf("Found node: %v\n", node)
 		nodes := rootNode.List(syntax, "Statement/IncludeDirective")
@@ -1,5 +1,7 @@
 package input
 
+import "unicode/utf8"
+
 type Input interface {
 	GetChar() rune
 	Skip() bool
@@ -28,7 +30,7 @@ func (i *StringInput) GetChar() rune {
 	if i.index >= len(i.input) {
 		return '\x00'
 	}
-	c := rune(i.input[i.index])
+	c, _ := utf8.DecodeRuneInString(i.input[i.index:])
 	return c
 }
 
@@ -36,7 +38,8 @@ func (i *StringInput) Skip() bool {
 	if i.index >= len(i.input) {
 		return false
 	}
-	i.index++
+	_, size := utf8.DecodeRuneInString(i.input[i.index:])
+	i.index += size
 	return true
 }
 
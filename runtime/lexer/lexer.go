@@ -14,7 +14,14 @@ type Lexer struct {
 	col         int
 	tokensLine  int
 	errors      []error.Error
-	tokens      []*Token
+	tokens      tokenBuffer
+	released    int
+	typesSets   map[int]int
+	mode        int
+	modes       []int
+	policy      RecoveryPolicy
+	errorTokens bool
+	errorSet    int
 	eof         bool
 	onlyIgnored bool
 }
@@ -30,14 +37,24 @@ type lexerState struct {
 
 const TKN_EOF = 0
 
+// eofSet is the index of the set of types of the end of input token.
+const eofSet = 0
+
 func New(vocabulary *Vocabulary, input input.Input) *Lexer {
-	return &Lexer{
+	l := &Lexer{
 		vocabulary: vocabulary,
 		input:      input,
 		index:      0,
 		row:        1,
 		col:        1,
+		typesSets:  make(map[int]int),
+		errorSet:   -1,
+	}
+	l.tokens.intern([]int{TKN_EOF})
+	if errorType := vocabulary.ErrorType(); errorType >= 0 {
+		l.errorSet = l.tokens.intern([]int{errorType})
 	}
+	return l
 }
 
 func (l *Lexer) Errors() []error.Error {
@@ -56,8 +73,10 @@ func (l *Lexer) InputIndex() int {
 	return l.input.Index()
 }
 
+// SetIndex moves the lexer to the token index. Indexes of released tokens and
+// of tokens not read yet are ignored.
 func (l *Lexer) SetIndex(newIndex int) {
-	if newIndex >= 0 && newIndex < len(l.tokens) {
+	if newIndex >= l.released && newIndex <= l.released+l.tokens.len() {
 		l.index = newIndex
 	}
 }
@@ -70,46 +89,80 @@ func (l *Lexer) Col() int {
 	return l.col
 }
 
+// Tokens reads the rest of the input, without moving the lexer, and returns the
+// tokens not released. The first token returned has the index Released().
 func (l *Lexer) Tokens() []*Token {
-	tkn, _ := l.NextToken()
-	for tkn != nil {
-		tkn, _ = l.NextToken()
+	l.readAll()
+	tokens := make([]*Token, l.tokens.len())
+	for i := range tokens {
+		tokens[i] = l.tokens.token(i)
 	}
-	return l.tokens
+	return tokens
+}
+
+// ReadAll reads the rest of the input without moving the lexer and returns the
+// index after the last token.
+func (l *Lexer) ReadAll() int {
+	l.readAll()
+	return l.released + l.tokens.len()
 }
 
+// readAll reads the tokens up to the end of input, or up to an invalid
+// character, without moving the lexer. Reaching the end of input is not an error.
+func (l *Lexer) readAll() {
+	index := l.index
+	l.index = l.released + l.tokens.len()
+	for !l.eof {
+		if _, err := l.NextToken(); err != nil {
+			break
+		}
+	}
+	l.index = index
+}
+
+// Token returns the token at the index, reading the tokens up to it.
 func (l *Lexer) Token(index int) (*Token, error.Error) {
-	for !l.eof && index >= len(l.tokens) {
-		token, err := l.readNextToken()
-		if err != nil {
+	if index < l.released {
+		return nil, newError(l.input.Index(), l.row, l.col, LEX_ERROR_RELEASED, "Token %d was released", index)
+	}
+	for !l.eof && index-l.released >= l.tokens.len() {
+		if _, err := l.readNextToken(); err != nil {
 			return nil, err
 		}
-		l.tokens = append(l.tokens, token)
 	}
-	if index < len(l.tokens) {
-		token := l.tokens[index]
-		return token, nil
+	if index-l.released < l.tokens.len() {
+		return l.tokens.token(index - l.released), nil
 	}
 	return nil, l.error(LEX_ERROR_EOF, l.input.Index(), l.row, l.col, "Unexpected end of file")
 }
 
+// Release drops the tokens before the index, which can not be read anymore, so
+// their memory is reclaimed. The tokens from the current index on are kept.
+func (l *Lexer) Release(index int) {
+	count := min(index, l.index) - l.released
+	if count <= 0 {
+		return
+	}
+	l.tokens.drop(count)
+	l.released += count
+}
+
+// Released returns the number of tokens released, that is the index of the
+// first token kept.
+func (l *Lexer) Released() int {
+	return l.released
+}
+
 func (l *Lexer) NextToken() (*Token, error.Error) {
-	if l.index < len(l.tokens) {
-		token := l.tokens[l.index]
+	if l.index-l.released < l.tokens.len() {
+		token := l.tokens.token(l.index - l.released)
 		l.index++
 		return token, nil
 	}
 	if l.input.Eof() {
 		if !l.eof {
 			l.eof = true
-			eofTkn := &Token{
-				index: l.input.Index(),
-				len:   0,
-				row:   l.row,
-				col:   l.col,
-				types: []int{TKN_EOF},
-			}
-			l.tokens = append(l.tokens, eofTkn)
+			eofTkn := l.newToken(l.input.Index(), 0, l.row, l.col, eofSet)
 			l.index++
 			return eofTkn, nil
 		} else {
@@ -120,69 +173,102 @@ func (l *Lexer) NextToken() (*Token, error.Error) {
 	if err != nil {
 		return nil, err
 	}
-	l.tokens = append(l.tokens, token)
 	l.index++
 	return token, nil
 }
 
+// Mode returns the index in the vocabulary of the current lexer mode.
+func (l *Lexer) Mode() int {
+	return l.mode
+}
+
+// readNextToken matches the next token and appends it to the tokens read.
 func (l *Lexer) readNextToken() (*Token, error.Error) {
-	var lastValidState *lexerState
+	token, err := l.matchToken()
+	if err == nil {
+		l.changeMode(token.types())
+	}
+	return token, err
+}
+
+// changeMode enters or leaves a lexer mode after a token of the types matches.
+// The first type that pushes or pops a mode is applied. Popping with no mode
+// pushed keeps the current one.
+func (l *Lexer) changeMode(types []int) {
+	for _, tokenType := range types {
+		if mode := l.vocabulary.PushMode(tokenType); mode >= 0 {
+			l.modes = append(l.modes, l.mode)
+			l.mode = mode
+			return
+		}
+		if l.vocabulary.HasOption(tokenType, rule.POP_MODE) {
+			if len(l.modes) > 0 {
+				l.mode = l.modes[len(l.modes)-1]
+				l.modes = l.modes[:len(l.modes)-1]
+			}
+			return
+		}
+	}
+}
+
+func (l *Lexer) matchToken() (*Token, error.Error) {
+	var lastValidState lexerState
+	hasLastValidState := false
 	col := l.col
 	row := l.row
 	state := 0
-	transitionsTable := l.vocabulary.TransitionsTable()
+	transitionsTable := l.vocabulary.ModeTransitionsTable(l.mode)
 	start := l.input.Index()
 	for {
 		var nextState int
 		c := l.input.GetChar()
 
-		if int(c) >= len(transitionsTable[state]) {
-			nextState = transitionsTable[state][0]
-		} else if int(c) > 0 {
-			nextState = transitionsTable[state][c]
+		if c > 0 {
+			nextState = transitionsTable[state][l.vocabulary.SymbolClass(c)]
 		} else if state == 0 {
 			return nil, l.error(LEX_ERROR_EOF, start, l.row, l.col, "Unexpected end of file")
-		} else if tt := l.validTokensTypes(state); len(tt) > 0 {
+		} else if set := l.validTokensTypes(state); len(l.tokens.sets[set]) > 0 {
 			if l.row > row {
 				l.onlyIgnored = true
 				l.tokensLine = 0
 			} else {
-				l.onlyIgnored = l.onlyIgnored && l.onlyIgnoredTypes(tt)
+				l.onlyIgnored = l.onlyIgnored && l.onlyIgnoredTypes(l.tokens.sets[set])
 				l.tokensLine++
 			}
-			return &Token{index: start, len: l.input.Index() - start, row: row, col: col, types: tt}, nil
+			return l.newToken(start, l.input.Index()-start, row, col, set), nil
 		}
 		if nextState == 0 {
-			tt := l.validTokensTypes(state)
-			if len(tt) == 0 {
+			set := l.validTokensTypes(state)
+			if len(l.tokens.sets[set]) == 0 {
 				// has a previous valid state, return it
-				if lastValidState != nil {
-					tt := l.validTokensTypes(lastValidState.state)
-					l.input.SetIndex(lastValidState.index + 1)
+				if hasLastValidState {
+					set := l.validTokensTypes(lastValidState.state)
+					l.input.SetIndex(lastValidState.index)
 					l.tokensLine = lastValidState.tokensLine
 					l.onlyIgnored = lastValidState.onlyIgnored
 					l.row = lastValidState.row
 					l.col = lastValidState.col
-					return &Token{index: start, len: l.input.Index() - start, row: row, col: col, types: tt}, nil
+					return l.newToken(start, l.input.Index()-start, row, col, set), nil
 				}
-				l.skipChar(c)
-				return nil, l.error(LEX_ERROR_INVALID_CHAR, start, l.row, l.col, "Invalid character '%c'", c)
+				return l.recover(start, row, col, c)
 			}
 			if l.row > row {
 				l.onlyIgnored = true
 				l.tokensLine = 0
 			} else {
-				l.onlyIgnored = l.onlyIgnored && l.onlyIgnoredTypes(tt)
+				l.onlyIgnored = l.onlyIgnored && l.onlyIgnoredTypes(l.tokens.sets[set])
 				l.tokensLine++
 			}
-			return &Token{index: start, len: l.input.Index() - start, row: row, col: col, types: tt}, nil
+			return l.newToken(start, l.input.Index()-start, row, col, set), nil
 		}
 		state = nextState
 		l.skipChar(c)
-		// store the last valid state if it is a final state
-		if l.vocabulary.IsFinalState(state) && !l.vocabulary.AllTokensTypesHasOption(state, rule.IGNORE) {
-			lastValidState = &lexerState{
-				index:       start,
+		// store the last valid state if it is a final state, with the index of the
+		// input after its token, where the lexer goes back when a longer token fails
+		if l.vocabulary.IsFinalStateInMode(l.mode, state) && !l.vocabulary.AllTokensTypesHasOptionInMode(l.mode, state, rule.IGNORE) {
+			hasLastValidState = true
+			lastValidState = lexerState{
+				index:       l.input.Index(),
 				state:       state,
 				row:         l.row,
 				col:         l.col,
@@ -193,8 +279,27 @@ func (l *Lexer) readNextToken() (*Token, error.Error) {
 	}
 }
 
-func (l *Lexer) validTokensTypes(state int) []int {
-	tokensTypes := l.vocabulary.TokenTypes(state)
+// validTokensTypes returns the index of the set of token types of the state
+// valid at the current position. The sets are shared by all the tokens with the
+// same types.
+func (l *Lexer) validTokensTypes(state int) int {
+	key := (state*l.vocabulary.ModesCount() + l.mode) << 2
+	if l.tokensLine == 0 {
+		key |= 1
+	}
+	if l.onlyIgnored {
+		key |= 2
+	}
+	if set, found := l.typesSets[key]; found {
+		return set
+	}
+	set := l.tokens.intern(l.filterTokensTypes(state))
+	l.typesSets[key] = set
+	return set
+}
+
+func (l *Lexer) filterTokensTypes(state int) []int {
+	tokensTypes := l.vocabulary.TokenTypesInMode(l.mode, state)
 	validTokens := make([]int, 0, len(tokensTypes))
 	for _, tokenType := range tokensTypes {
 		if !l.vocabulary.HasOptions(tokenType) {
@@ -214,6 +319,12 @@ func (l *Lexer) validTokensTypes(state int) []int {
 	return validTokens
 }
 
+// newToken appends the token with the set of types to the tokens read.
+func (l *Lexer) newToken(index, length, row, col int, set int) *Token {
+	l.tokens.push(index, length, row, col, set)
+	return l.tokens.token(l.tokens.len() - 1)
+}
+
 func (l *Lexer) onlyIgnoredTypes(tokenTypes []int) bool {
 	for _, t := range tokenTypes {
 		if !l.vocabulary.HasOption(t, rule.IGNORE) {
@@ -243,7 +354,7 @@ func (l *Lexer) error(code int, index int, row int, col int, message string, arg
 }
 
 func (l *Lexer) IsIgnored(tkn *Token) bool {
-	for _, tt := range tkn.types {
+	for _, tt := range tkn.types() {
 		if l.vocabulary.HasOption(tt, rule.IGNORE) {
 			return true
 		}
@@ -251,6 +362,34 @@ func (l *Lexer) IsIgnored(tkn *Token) bool {
 	return false
 }
 
+// TokenChannel returns the channel of the token, the first channel other than
+// the default one of its types.
+func (l *Lexer) TokenChannel(tkn *Token) int {
+	for _, tt := range tkn.types() {
+		if channel := l.vocabulary.TokenChannel(tt); channel > 0 {
+			return channel
+		}
+	}
+	return 0
+}
+
+// TokensOnChannel returns the tokens not released on the channel with the name,
+// reading the tokens not read yet without moving the lexer.
+func (l *Lexer) TokensOnChannel(name string) []*Token {
+	channel := l.vocabulary.ChannelIndex(name)
+	if channel < 0 {
+		return nil
+	}
+	tokens := l.Tokens()
+	channelTokens := make([]*Token, 0)
+	for _, tkn := range tokens {
+		if l.TokenChannel(tkn) == channel {
+			channelTokens = append(channelTokens, tkn)
+		}
+	}
+	return channelTokens
+}
+
 func (l *Lexer) Vocabulary() *Vocabulary {
 	return l.vocabulary
 }
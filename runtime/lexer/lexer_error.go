@@ -17,6 +17,10 @@ type lexerError struct {
 const LEX_ERROR_EOF = 1
 const LEX_ERROR_INVALID_CHAR = 2
 
+// LEX_ERROR_RELEASED is the code of the error returned reading a released token,
+// which is not added to the errors of the lexer.
+const LEX_ERROR_RELEASED = 3
+
 var _ error.Error = &lexerError{}
 
 func newError(index, row, col, code int, message string, args ...any) *lexerError {
@@ -0,0 +1,186 @@
+package lexer_test
+
+import (
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+)
+
+const scriptsGrammar = `grammar Scripts;
+
+Program : (Cyrillic | Han | Emoji | Latin)* EOI;
+
+@Token
+Cyrillic : [а-я]+;
+
+@Token
+Han : [一-龥]+;
+
+@Token
+Emoji : [😀-🙏]+;
+
+@Token
+Latin : [a-z]+;
+
+@Ignore
+Spaces : (' ' | '\n')+;
+`
+
+// newLexer creates a lexer of the source with the vocabulary of the grammar.
+func newLexer(t testing.TB, grammarSource string, source string) *lexer.Lexer {
+	t.Helper()
+	g, err := grammar.FromString(grammarSource)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	return lexer.New(vocabulary.FromGrammar(g), input.NewStringInput(source))
+}
+
+// lexedToken is a token with the name of its first type and its text.
+type lexedToken struct {
+	name string
+	text string
+	col  int
+}
+
+// lexAll reads all the tokens of the source, but the ignored ones and the end
+// of input, failing the test on errors.
+func lexAll(t testing.TB, l *lexer.Lexer, source string) []lexedToken {
+	t.Helper()
+	var tokens []lexedToken
+	for _, tkn := range l.Tokens() {
+		if tkn.IsType(lexer.TKN_EOF) || l.IsIgnored(tkn) {
+			continue
+		}
+		name := l.Vocabulary().TokenName(tkn.Type(0))
+		tokens = append(tokens, lexedToken{name: name, text: source[tkn.Index() : tkn.Index()+tkn.Len()], col: tkn.Col()})
+	}
+	if len(l.Errors()) > 0 {
+		t.Fatalf("got errors %v reading %q", l.Errors(), source)
+	}
+	return tokens
+}
+
+func TestNonLatinRanges(t *testing.T) {
+	source := "привет 漢字 😀😎 abc язык"
+	l := newLexer(t, scriptsGrammar, source)
+	want := []lexedToken{
+		{name: "Cyrillic", text: "привет", col: 1},
+		{name: "Han", text: "漢字", col: 8},
+		{name: "Emoji", text: "😀😎", col: 11},
+		{name: "Latin", text: "abc", col: 14},
+		{name: "Cyrillic", text: "язык", col: 18},
+	}
+	got := lexAll(t, l, source)
+	if len(got) != len(want) {
+		t.Fatalf("got tokens %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got token %v, want %v", got[i], want[i])
+		}
+	}
+}
+
+func TestSymbolsOutOfRanges(t *testing.T) {
+	for _, source := range []string{"ё", "〇", "🚀", "Я"} {
+		l := newLexer(t, scriptsGrammar, source)
+		l.Tokens()
+		if len(l.Errors()) == 0 {
+			t.Errorf("got no errors reading %q out of the ranges", source)
+		}
+	}
+}
+
+func TestSymbolsClasses(t *testing.T) {
+	v := newLexer(t, scriptsGrammar, "").Vocabulary()
+	// the symbols of each range share a class, besides the spaces, the new
+	// lines and the symbols without transitions
+	if got := v.ClassesCount(); got != 7 {
+		t.Errorf("got %d classes, want 7", got)
+	}
+	ranges := [][2]rune{{'а', 'я'}, {'一', '龥'}, {'😀', '🙏'}, {'a', 'z'}}
+	classes := make(map[int]bool)
+	for _, r := range ranges {
+		class := v.SymbolClass(r[0])
+		for _, symbol := range []rune{r[0] + 1, (r[0] + r[1]) / 2, r[1]} {
+			if v.SymbolClass(symbol) != class {
+				t.Errorf("got class %d for %q, want the class %d of %q", v.SymbolClass(symbol), symbol, class, r[0])
+			}
+		}
+		if v.SymbolClass(r[0]-1) == class || v.SymbolClass(r[1]+1) == class {
+			t.Errorf("got the class %d of %q-%q out of the range", class, r[0], r[1])
+		}
+		classes[class] = true
+	}
+	if len(classes) != len(ranges) {
+		t.Errorf("got %d classes for %d ranges", len(classes), len(ranges))
+	}
+}
+
+func TestVocabularyOfSymbols(t *testing.T) {
+	table := [][]int{make([]int, 'c'), make([]int, 'c')}
+	table[0]['a'] = 1
+	table[0]['b'] = 1
+	v := lexer.NewVocabulary([]string{"EOI", "AB"}, []int{0, 0}, table, [][]int{{}, {1}})
+	for _, symbol := range []rune{'a', 'b', '\n'} {
+		if v.SymbolClass(symbol) != int(symbol) {
+			t.Errorf("got class %d for %q, want its column", v.SymbolClass(symbol), symbol)
+		}
+	}
+	// the symbols beyond the last column use the column 0
+	for _, symbol := range []rune{'c', 'z', 'я', '😀'} {
+		if v.SymbolClass(symbol) != 0 {
+			t.Errorf("got class %d for %q, want 0", v.SymbolClass(symbol), symbol)
+		}
+	}
+}
+
+const numbersGrammar = `grammar Numbers;
+
+Program : (Number | Range | Dot | Ident)* EOI;
+
+@Token
+Number : [0-9]+ ('.' [0-9]+ ('e' [0-9]+)?)?;
+
+@Token
+Range : '..';
+
+@Token
+Dot : '.';
+
+@Token
+Ident : ([a-z] | [а-я])+;
+
+@Ignore
+Spaces : (' ' | '\n')+;
+`
+
+func TestLongestMatchBacktracking(t *testing.T) {
+	tests := []struct {
+		source string
+		want   []lexedToken
+	}{
+		{source: "12.x", want: []lexedToken{{"Number", "12", 1}, {"Dot", ".", 3}, {"Ident", "x", 4}}},
+		{source: "1.5ex", want: []lexedToken{{"Number", "1.5", 1}, {"Ident", "ex", 4}}},
+		{source: "1.5e7", want: []lexedToken{{"Number", "1.5e7", 1}}},
+		{source: "34..", want: []lexedToken{{"Number", "34", 1}, {"Range", "..", 3}}},
+		{source: "7.я", want: []lexedToken{{"Number", "7", 1}, {"Dot", ".", 2}, {"Ident", "я", 3}}},
+		{source: "9.5eя", want: []lexedToken{{"Number", "9.5", 1}, {"Ident", "eя", 4}}},
+	}
+	for _, test := range tests {
+		got := lexAll(t, newLexer(t, numbersGrammar, test.source), test.source)
+		if len(got) != len(test.want) {
+			t.Errorf("got tokens %v reading %q, want %v", got, test.source, test.want)
+			continue
+		}
+		for i := range test.want {
+			if got[i] != test.want[i] {
+				t.Errorf("got token %v reading %q, want %v", got[i], test.source, test.want[i])
+			}
+		}
+	}
+}
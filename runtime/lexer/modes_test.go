@@ -0,0 +1,183 @@
+package lexer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/runtime/lexer"
+)
+
+const templatesGrammar = `grammar Templates;
+
+Program : (Ident | Close | Quote)* EOI;
+
+@Mode(DEFAULT, CODE)
+Ident : [a-z]+;
+
+@Mode(DEFAULT, CODE)
+@PopMode
+Close : '}';
+
+@Mode(DEFAULT, CODE)
+@PushMode(TEXT)
+Quote : '"';
+
+@Mode(TEXT)
+@PopMode
+EndQuote : '"';
+
+@Mode(TEXT)
+Text : ([a-z] | ' ')+;
+
+@Mode(TEXT)
+@PushMode(CODE)
+Interpolation : '{';
+
+@Mode(DEFAULT, CODE)
+@Ignore
+Spaces : (' ' | '\n')+;
+`
+
+// modeToken is a token with its text and the mode of the lexer after it.
+type modeToken struct {
+	name string
+	text string
+	mode string
+}
+
+// lexModes reads the tokens of the source, but the ignored ones and the end of
+// input, with the modes entered after them.
+func lexModes(t testing.TB, l *lexer.Lexer, source string) []modeToken {
+	t.Helper()
+	var tokens []modeToken
+	for {
+		tkn, err := l.NextToken()
+		if err != nil {
+			t.Fatalf("got error %v reading %q", err, source)
+		}
+		if tkn.IsType(lexer.TKN_EOF) {
+			return tokens
+		}
+		if !l.IsIgnored(tkn) {
+			tokens = append(tokens, modeToken{
+				name: l.Vocabulary().TokenName(tkn.Type(0)),
+				text: source[tkn.Index() : tkn.Index()+tkn.Len()],
+				mode: l.Vocabulary().ModeName(l.Mode()),
+			})
+		}
+	}
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []modeToken
+	}{
+		{
+			name:   "push and pop",
+			source: `a "b c" d`,
+			want: []modeToken{
+				{"Ident", "a", "DEFAULT"},
+				{"Quote", `"`, "TEXT"},
+				{"Text", "b c", "TEXT"},
+				{"EndQuote", `"`, "DEFAULT"},
+				{"Ident", "d", "DEFAULT"},
+			},
+		},
+		{
+			name:   "nested push",
+			source: `"x {b "y {c} z" d} w" e`,
+			want: []modeToken{
+				{"Quote", `"`, "TEXT"},
+				{"Text", "x ", "TEXT"},
+				{"Interpolation", "{", "CODE"},
+				{"Ident", "b", "CODE"},
+				{"Quote", `"`, "TEXT"},
+				{"Text", "y ", "TEXT"},
+				{"Interpolation", "{", "CODE"},
+				{"Ident", "c", "CODE"},
+				{"Close", "}", "TEXT"},
+				{"Text", " z", "TEXT"},
+				{"EndQuote", `"`, "CODE"},
+				{"Ident", "d", "CODE"},
+				{"Close", "}", "TEXT"},
+				{"Text", " w", "TEXT"},
+				{"EndQuote", `"`, "DEFAULT"},
+				{"Ident", "e", "DEFAULT"},
+			},
+		},
+		{
+			name:   "pop on an empty stack",
+			source: `a } } "b"`,
+			want: []modeToken{
+				{"Ident", "a", "DEFAULT"},
+				{"Close", "}", "DEFAULT"},
+				{"Close", "}", "DEFAULT"},
+				{"Quote", `"`, "TEXT"},
+				{"Text", "b", "TEXT"},
+				{"EndQuote", `"`, "DEFAULT"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := lexModes(t, newLexer(t, templatesGrammar, test.source), test.source)
+			if len(got) != len(test.want) {
+				t.Fatalf("got tokens %v, want %v", got, test.want)
+			}
+			for i := range test.want {
+				if got[i] != test.want[i] {
+					t.Errorf("got token %v, want %v", got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestModeRulesNotMatchedInOtherModes(t *testing.T) {
+	// the spaces are ignored outside the strings only, and a quote starts a
+	// string inside an interpolation instead of ending the string around it
+	l := newLexer(t, templatesGrammar, `"a b" }x`)
+	got := lexModes(t, l, `"a b" }x`)
+	if len(got) != 5 || got[1] != (modeToken{"Text", "a b", "TEXT"}) || got[4] != (modeToken{"Ident", "x", "DEFAULT"}) {
+		t.Errorf("got tokens %v", got)
+	}
+	source := `"{"`
+	l = newLexer(t, templatesGrammar, source)
+	got = lexModes(t, l, source)
+	if len(got) != 3 || got[2] != (modeToken{"Quote", `"`, "TEXT"}) {
+		t.Errorf("got tokens %v reading %q, want a quote that starts a string inside the interpolation", got, source)
+	}
+}
+
+func TestUndefinedModes(t *testing.T) {
+	g, err := grammar.FromString(`grammar Undefined;
+
+Program : (Ident | Quote)* EOI;
+
+Ident : [a-z]+;
+
+@PushMode(STRING)
+Quote : '"';
+
+@Mode(TEXT)
+@PopMode
+EndQuote : '"';
+`)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	errors := g.Errors()
+	if len(errors) != 1 || !strings.Contains(errors[0].Error(), "'Quote' pushes the undefined mode 'STRING'") {
+		t.Errorf("got errors %v, want the undefined mode pushed by Quote", errors)
+	}
+	g, err = grammar.FromString(templatesGrammar)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	if g.HasError() {
+		t.Errorf("got errors %v, want none", g.Errors())
+	}
+}
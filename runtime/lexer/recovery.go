@@ -0,0 +1,94 @@
+package lexer
+
+import (
+	"unicode"
+
+	"github.com/fabiouggeri/page/runtime/error"
+)
+
+// RecoveryPolicy says which characters the lexer skips when no token matches.
+type RecoveryPolicy int
+
+const (
+	// SKIP_CHAR skips the character where the match failed.
+	SKIP_CHAR RecoveryPolicy = iota
+	// SKIP_TO_SPACE skips the characters up to the next white space.
+	SKIP_TO_SPACE
+	// SKIP_TO_LINE skips the characters up to the end of the line.
+	SKIP_TO_LINE
+)
+
+func (l *Lexer) SetRecoveryPolicy(policy RecoveryPolicy) {
+	l.policy = policy
+}
+
+func (l *Lexer) RecoveryPolicy() RecoveryPolicy {
+	return l.policy
+}
+
+// SetErrorTokens sets whether the lexer returns an error token, of the type
+// ErrorType of the vocabulary, when no token matches, instead of returning an
+// error. The error token covers the characters skipped by the recovery policy
+// and the following characters that can not start a token, and the error is
+// still recorded in Errors. Error tokens are ignored, so the parser skips them
+// like spaces and comments, reporting an error for each one. Vocabularies
+// without the error type always return errors.
+func (l *Lexer) SetErrorTokens(errorTokens bool) {
+	l.errorTokens = errorTokens
+}
+
+func (l *Lexer) ErrorTokens() bool {
+	return l.errorTokens
+}
+
+// recover skips the characters by the recovery policy after no token matched
+// the character, returning an error or an error token from the start.
+func (l *Lexer) recover(start, row, col int, c rune) (*Token, error.Error) {
+	l.skipChar(c)
+	if !l.errorTokens || l.errorSet < 0 {
+		err := l.error(LEX_ERROR_INVALID_CHAR, start, l.row, l.col, "Invalid character '%c'", c)
+		l.skipByPolicy()
+		return nil, err
+	}
+	l.skipByPolicy()
+	for next := l.input.GetChar(); next > 0 && !l.canStartToken(next); next = l.input.GetChar() {
+		l.skipChar(next)
+	}
+	text := l.input.GetText(start, l.input.Index())
+	if len([]rune(text)) > 1 {
+		l.error(LEX_ERROR_INVALID_CHAR, start, row, col, "Invalid characters '%s'", text)
+	} else {
+		l.error(LEX_ERROR_INVALID_CHAR, start, row, col, "Invalid character '%c'", c)
+	}
+	if l.row > row {
+		l.onlyIgnored = true
+		l.tokensLine = 0
+	} else {
+		l.onlyIgnored = l.onlyIgnored && l.onlyIgnoredTypes(l.tokens.sets[l.errorSet])
+		l.tokensLine++
+	}
+	return l.newToken(start, l.input.Index()-start, row, col, l.errorSet), nil
+}
+
+func (l *Lexer) skipByPolicy() {
+	for c := l.input.GetChar(); c > 0; c = l.input.GetChar() {
+		switch l.policy {
+		case SKIP_TO_SPACE:
+			if unicode.IsSpace(c) {
+				return
+			}
+		case SKIP_TO_LINE:
+			if c == '\n' {
+				return
+			}
+		default:
+			return
+		}
+		l.skipChar(c)
+	}
+}
+
+// canStartToken reports whether a token of the current mode can start with the character.
+func (l *Lexer) canStartToken(c rune) bool {
+	return l.vocabulary.ModeTransitionsTable(l.mode)[0][l.vocabulary.SymbolClass(c)] != 0
+}
@@ -1,54 +1,158 @@
 package lexer
 
+import "slices"
+
+// Token is a view of a token kept by the buffer of the lexer. The fields of the
+// tokens are stored in arrays of numbers, and each token is given by a view of
+// its position in them, allocated along with the arrays, so tokens are not
+// objects of their own in the heap. Views stay valid after their tokens are
+// released by the lexer.
 type Token struct {
-	index int
-	len   int
-	row   int
-	col   int
-	types []int
+	block *tokensBlock
+	i     int32
 }
 
+// NewToken creates a token with the types, kept by a buffer of its own.
 func NewToken(index, len, row, col int, types []int) *Token {
-	return &Token{
-		index: index,
-		len:   len,
-		row:   row,
-		col:   col,
-		types: types,
-	}
+	buffer := &tokenBuffer{}
+	buffer.push(index, len, row, col, buffer.intern(types))
+	return buffer.token(0)
 }
 
 func (t *Token) Index() int {
-	return t.index
+	return t.block.starts[t.i]
 }
 
 func (t *Token) Len() int {
-	return t.len
+	return int(t.block.lens[t.i])
 }
 
 func (t *Token) Row() int {
-	return t.row
+	return int(t.block.rows[t.i])
 }
 
 func (t *Token) Col() int {
-	return t.col
+	return int(t.block.cols[t.i])
 }
 
+// Types returns a copy of the types of the token. The types are shared by all
+// the tokens with the same ones, so they can not be changed.
 func (t *Token) Types() []int {
-	return t.types
+	return slices.Clone(t.types())
+}
+
+// TypesCount returns the number of types of the token.
+func (t *Token) TypesCount() int {
+	return len(t.types())
+}
+
+// Type returns the type of the token at the position among its types.
+func (t *Token) Type(i int) int {
+	return t.types()[i]
 }
 
 func (t *Token) IsType(tokenType int) bool {
-	if len(t.types) == 0 {
+	types := t.types()
+	if len(types) == 0 {
 		return false
 	}
-	if t.types[0] == tokenType {
+	if types[0] == tokenType {
 		return true
 	}
-	for i := 1; i < len(t.types); i++ {
-		if t.types[i] == tokenType {
+	for i := 1; i < len(types); i++ {
+		if types[i] == tokenType {
 			return true
 		}
 	}
 	return false
 }
+
+func (t *Token) types() []int {
+	return t.block.buffer.sets[t.block.types[t.i]]
+}
+
+// tokensBlockBits gives the number of tokens of the blocks of the token buffer.
+const tokensBlockBits = 10
+
+// tokensBlockSize is the number of tokens of the blocks of the token buffer.
+const tokensBlockSize = 1 << tokensBlockBits
+
+// tokensBlock keeps the fields of the tokens in arrays of numbers, which the
+// garbage collector does not scan, and the views of the tokens. The types of a
+// token are the index of their set among the sets of types of the buffer.
+type tokensBlock struct {
+	buffer *tokenBuffer
+	starts []int
+	lens   []int32
+	rows   []int32
+	cols   []int32
+	types  []int32
+	views  []Token
+}
+
+func newTokensBlock(buffer *tokenBuffer, size int) *tokensBlock {
+	return &tokensBlock{
+		buffer: buffer,
+		starts: make([]int, 0, size),
+		lens:   make([]int32, 0, size),
+		rows:   make([]int32, 0, size),
+		cols:   make([]int32, 0, size),
+		types:  make([]int32, 0, size),
+		views:  make([]Token, 0, size),
+	}
+}
+
+// tokenBuffer keeps the tokens read by the lexer in blocks. The tokens dropped
+// are the first ones, so the blocks before the first token kept are released.
+type tokenBuffer struct {
+	blocks []*tokensBlock
+	first  int
+	count  int
+	sets   [][]int
+}
+
+func (b *tokenBuffer) len() int {
+	return b.count
+}
+
+func (b *tokenBuffer) push(index, length, row, col int, set int) {
+	position := b.first + b.count
+	if position>>tokensBlockBits == len(b.blocks) {
+		b.blocks = append(b.blocks, newTokensBlock(b, tokensBlockSize))
+	}
+	block := b.blocks[position>>tokensBlockBits]
+	block.starts = append(block.starts, index)
+	block.lens = append(block.lens, int32(length))
+	block.rows = append(block.rows, int32(row))
+	block.cols = append(block.cols, int32(col))
+	block.types = append(block.types, int32(set))
+	block.views = append(block.views, Token{block: block, i: int32(len(block.views))})
+	b.count++
+}
+
+func (b *tokenBuffer) token(index int) *Token {
+	position := b.first + index
+	return &b.blocks[position>>tokensBlockBits].views[position&(tokensBlockSize-1)]
+}
+
+// drop removes the first count tokens, releasing the blocks left without tokens.
+func (b *tokenBuffer) drop(count int) {
+	b.first += count
+	b.count -= count
+	if released := b.first >> tokensBlockBits; released > 0 {
+		kept := copy(b.blocks, b.blocks[released:])
+		clear(b.blocks[kept:])
+		b.blocks = b.blocks[:kept]
+		b.first -= released << tokensBlockBits
+	}
+}
+
+// intern returns the index of the set of types, adding it when the buffer does
+// not have an equal one yet, so the tokens with the same types share their set.
+func (b *tokenBuffer) intern(types []int) int {
+	if set := slices.IndexFunc(b.sets, func(set []int) bool { return slices.Equal(set, types) }); set >= 0 {
+		return set
+	}
+	b.sets = append(b.sets, types)
+	return len(b.sets) - 1
+}
@@ -1,26 +1,199 @@
 package lexer
 
 import (
+	"slices"
 	"strings"
+	"unicode"
 
 	"github.com/fabiouggeri/page/build/rule"
 	"github.com/fabiouggeri/page/util"
 )
 
+// Vocabulary holds the tokens and the automata of the lexer. Each lexer mode
+// has its own transitions and tokens tables, and the tables given to
+// NewVocabulary are the ones of the default mode.
+//
+// The symbols are grouped in classes of symbols with the same transitions in
+// every state, and the transitions tables have a column for each class. The
+// classes are given by sorted intervals of symbols: the symbols from each start
+// up to the next one belong to the class at the same position.
+//
+// NewVocabulary takes tables with a column for each symbol, where the column 0 is
+// the one of the symbols beyond the last column, and NewVocabularyWithClasses
+// takes the tables of the classes with their intervals.
 type Vocabulary struct {
 	tokensNames      []string
 	tokensOptions    []int
+	symbolsStarts    []rune
+	symbolsClasses   []int
+	directClasses    []int
 	transitionsTable [][]int
 	tokensTypes      [][]int
+	modesNames       []string
+	modesTransitions [][][]int
+	modesTokensTypes [][][]int
+	pushModes        []int
+	channelsNames    []string
+	tokensChannels   []int
 }
 
+// directClassesSize is the number of symbols whose classes are found without a search.
+const directClassesSize = 256
+
 func NewVocabulary(tokensNames []string, tokensOptions []int, transitionsTable [][]int, tokensTypes [][]int) *Vocabulary {
-	return &Vocabulary{
+	symbols := 0
+	if len(transitionsTable) > 0 {
+		symbols = len(transitionsTable[0])
+	}
+	symbolsStarts := make([]rune, symbols+1)
+	symbolsClasses := make([]int, symbols+1)
+	for symbol := range symbols {
+		symbolsStarts[symbol] = rune(symbol)
+		symbolsClasses[symbol] = symbol
+	}
+	symbolsStarts[symbols] = rune(symbols)
+	return NewVocabularyWithClasses(tokensNames, tokensOptions, symbolsStarts, symbolsClasses, transitionsTable, tokensTypes)
+}
+
+func NewVocabularyWithClasses(tokensNames []string, tokensOptions []int, symbolsStarts []rune, symbolsClasses []int,
+	transitionsTable [][]int, tokensTypes [][]int) *Vocabulary {
+	v := &Vocabulary{
 		tokensNames:      tokensNames,
 		tokensOptions:    tokensOptions,
+		symbolsStarts:    symbolsStarts,
+		symbolsClasses:   symbolsClasses,
 		transitionsTable: transitionsTable,
 		tokensTypes:      tokensTypes,
+		modesNames:       []string{rule.DEFAULT_MODE},
+		modesTransitions: [][][]int{transitionsTable},
+		modesTokensTypes: [][][]int{tokensTypes},
+		channelsNames:    []string{rule.DEFAULT_CHANNEL},
+	}
+	v.directClasses = make([]int, directClassesSize)
+	for symbol := range v.directClasses {
+		v.directClasses[symbol] = v.searchClass(rune(symbol))
+	}
+	return v
+}
+
+// SymbolClass returns the class of the symbol, that is the column of the
+// transitions tables for the symbol.
+func (v *Vocabulary) SymbolClass(symbol rune) int {
+	if symbol >= 0 && int(symbol) < len(v.directClasses) {
+		return v.directClasses[symbol]
+	}
+	return v.searchClass(symbol)
+}
+
+func (v *Vocabulary) searchClass(symbol rune) int {
+	index, found := slices.BinarySearch(v.symbolsStarts, symbol)
+	if !found {
+		index--
+	}
+	if index < 0 {
+		return 0
+	}
+	return v.symbolsClasses[index]
+}
+
+func (v *Vocabulary) ClassesCount() int {
+	if len(v.transitionsTable) == 0 {
+		return 0
+	}
+	return len(v.transitionsTable[0])
+}
+
+// AddMode adds a lexer mode with its tables and returns its index.
+func (v *Vocabulary) AddMode(name string, transitionsTable [][]int, tokensTypes [][]int) int {
+	v.modesNames = append(v.modesNames, name)
+	v.modesTransitions = append(v.modesTransitions, transitionsTable)
+	v.modesTokensTypes = append(v.modesTokensTypes, tokensTypes)
+	return len(v.modesNames) - 1
+}
+
+func (v *Vocabulary) ModesCount() int {
+	return len(v.modesNames)
+}
+
+func (v *Vocabulary) ModeName(mode int) string {
+	if mode < 0 || mode >= len(v.modesNames) {
+		return ""
+	}
+	return v.modesNames[mode]
+}
+
+func (v *Vocabulary) ModeIndex(name string) int {
+	for i, modeName := range v.modesNames {
+		if modeName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *Vocabulary) ModeTransitionsTable(mode int) [][]int {
+	return v.modesTransitions[mode]
+}
+
+// SetPushMode sets the mode entered when a token of the type matches.
+func (v *Vocabulary) SetPushMode(tokenType int, mode int) {
+	if v.pushModes == nil {
+		v.pushModes = make([]int, len(v.tokensNames))
+		for i := range v.pushModes {
+			v.pushModes[i] = -1
+		}
+	}
+	v.pushModes[tokenType] = mode
+}
+
+// PushMode returns the mode entered when a token of the type matches, or -1.
+func (v *Vocabulary) PushMode(tokenType int) int {
+	if v.pushModes == nil || tokenType < 0 || tokenType >= len(v.pushModes) {
+		return -1
+	}
+	return v.pushModes[tokenType]
+}
+
+// AddChannel adds a token channel and returns its index.
+func (v *Vocabulary) AddChannel(name string) int {
+	v.channelsNames = append(v.channelsNames, name)
+	return len(v.channelsNames) - 1
+}
+
+func (v *Vocabulary) ChannelsCount() int {
+	return len(v.channelsNames)
+}
+
+func (v *Vocabulary) ChannelName(channel int) string {
+	if channel < 0 || channel >= len(v.channelsNames) {
+		return ""
+	}
+	return v.channelsNames[channel]
+}
+
+func (v *Vocabulary) ChannelIndex(name string) int {
+	for i, channelName := range v.channelsNames {
+		if channelName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetTokenChannel sets the channel of the tokens of the type.
+func (v *Vocabulary) SetTokenChannel(tokenType int, channel int) {
+	if v.tokensChannels == nil {
+		v.tokensChannels = make([]int, len(v.tokensNames))
+	}
+	v.tokensChannels[tokenType] = channel
+}
+
+// TokenChannel returns the channel of the tokens of the type, 0 for the default channel.
+func (v *Vocabulary) TokenChannel(tokenType int) int {
+	if v.tokensChannels == nil || tokenType < 0 || tokenType >= len(v.tokensChannels) {
+		return 0
 	}
+	return v.tokensChannels[tokenType]
 }
 
 func (v *Vocabulary) TokensNames() []string {
@@ -32,10 +205,15 @@ func (v *Vocabulary) TransitionsTable() [][]int {
 }
 
 func (v *Vocabulary) TokenTypes(index int) []int {
-	if index < 0 || index >= len(v.tokensTypes) {
+	return v.TokenTypesInMode(0, index)
+}
+
+func (v *Vocabulary) TokenTypesInMode(mode int, index int) []int {
+	tokensTypes := v.modesTokensTypes[mode]
+	if index < 0 || index >= len(tokensTypes) {
 		return []int{}
 	}
-	return v.tokensTypes[index]
+	return tokensTypes[index]
 }
 
 func (v *Vocabulary) String() string {
@@ -46,6 +224,15 @@ func (v *Vocabulary) String() string {
 	return s.String()
 }
 
+// ErrorType returns the type of the error tokens, the last type when it is named
+// ERROR, or -1 when the vocabulary has no such type.
+func (v *Vocabulary) ErrorType() int {
+	if last := len(v.tokensNames) - 1; last > 0 && v.tokensNames[last] == "ERROR" {
+		return last
+	}
+	return -1
+}
+
 func (v *Vocabulary) TokenName(index int) string {
 	if index < 0 || index >= len(v.tokensNames) {
 		return ""
@@ -73,9 +260,16 @@ func (v *Vocabulary) HasOption(tokenType int, option *rule.RuleOption) bool {
 func (v *Vocabulary) Write(writer util.TextWriter) {
 	v.writeTokensNames(writer)
 	writer.NewLine()
-	v.writeTokensTypes(writer)
-	writer.NewLine()
-	v.writeTransitionsTable(writer)
+	v.writeSymbolsClasses(writer)
+	for mode := range v.modesNames {
+		if mode > 0 {
+			writer.NewLine().WriteString("Mode ").WriteString(v.modesNames[mode]).NewLine()
+		}
+		writer.NewLine()
+		v.writeTokensTypes(writer, v.modesTokensTypes[mode])
+		writer.NewLine()
+		v.writeTransitionsTable(writer, v.modesTransitions[mode])
+	}
 }
 
 func (v *Vocabulary) writeTokensNames(writer util.TextWriter) {
@@ -86,19 +280,23 @@ func (v *Vocabulary) writeTokensNames(writer util.TextWriter) {
 	}
 	writer.Indent(3)
 	for i, t := range v.tokensNames {
-		writer.WriteF("%d - %s", i, t).NewLine()
+		writer.WriteF("%d - %s", i, t)
+		if channel := v.TokenChannel(i); channel > 0 {
+			writer.WriteF(" (%s)", v.channelsNames[channel])
+		}
+		writer.NewLine()
 	}
 	writer.Indent(-3)
 }
 
-func (v *Vocabulary) writeTokensTypes(writer util.TextWriter) {
+func (v *Vocabulary) writeTokensTypes(writer util.TextWriter, tokensTypes [][]int) {
 	writer.WriteString("Tokens Types:").NewLine()
 	writer.WriteString("=============").NewLine()
-	if len(v.tokensTypes) == 0 {
+	if len(tokensTypes) == 0 {
 		return
 	}
 	writer.Indent(3)
-	for stateIndex, types := range v.tokensTypes {
+	for stateIndex, types := range tokensTypes {
 		writer.WriteF("%d: ", stateIndex)
 		for typeIndex, t := range types {
 			if typeIndex > 0 {
@@ -111,19 +309,19 @@ func (v *Vocabulary) writeTokensTypes(writer util.TextWriter) {
 	writer.Indent(-3)
 }
 
-func (v *Vocabulary) writeTransitionsTable(writer util.TextWriter) {
+func (v *Vocabulary) writeTransitionsTable(writer util.TextWriter, transitionsTable [][]int) {
 	writer.WriteString("Transitions Table:").NewLine()
 	writer.WriteString("==================").NewLine()
-	if len(v.transitionsTable) == 0 {
+	if len(transitionsTable) == 0 {
 		return
 	}
 	writer.Indent(3)
 	writer.WriteString("State")
-	for symbol := range v.transitionsTable[0] {
-		v.writeSymbol(writer, rune(symbol))
+	for class := range transitionsTable[0] {
+		writer.WriteF(" %3d", class)
 	}
 	writer.NewLine()
-	for state, stateTransitions := range v.transitionsTable {
+	for state, stateTransitions := range transitionsTable {
 		writer.WriteF("%5d", state)
 		for _, symbol := range stateTransitions {
 			writer.WriteF(" %3d", symbol)
@@ -133,26 +331,60 @@ func (v *Vocabulary) writeTransitionsTable(writer util.TextWriter) {
 	writer.Indent(-3)
 }
 
+func (v *Vocabulary) writeSymbolsClasses(writer util.TextWriter) {
+	writer.WriteString("Symbols Classes:").NewLine()
+	writer.WriteString("================").NewLine()
+	writer.Indent(3)
+	for class := 0; class < v.ClassesCount(); class++ {
+		writer.WriteF("%d:", class)
+		for i, start := range v.symbolsStarts {
+			if v.symbolsClasses[i] != class {
+				continue
+			}
+			end := rune(unicode.MaxRune)
+			if i+1 < len(v.symbolsStarts) {
+				end = v.symbolsStarts[i+1] - 1
+			}
+			writer.WriteRune(' ')
+			v.writeSymbol(writer, start)
+			if end > start {
+				writer.WriteRune('-')
+				v.writeSymbol(writer, end)
+			}
+		}
+		writer.NewLine()
+	}
+	writer.Indent(-3)
+}
+
 func (v *Vocabulary) writeSymbol(writer util.TextWriter, symbol rune) {
 	if symbol <= 32 || symbol >= 127 {
-		writer.WriteF(" %3d", symbol)
+		writer.WriteF("%d", symbol)
 	} else {
-		writer.WriteF(" '%c'", symbol)
+		writer.WriteF("'%c'", symbol)
 	}
 }
 
 func (v *Vocabulary) IsFinalState(state int) bool {
-	if state > 0 && state < len(v.transitionsTable) {
-		return len(v.tokensTypes[state]) > 0
+	return v.IsFinalStateInMode(0, state)
+}
+
+func (v *Vocabulary) IsFinalStateInMode(mode int, state int) bool {
+	if state > 0 && state < len(v.modesTransitions[mode]) {
+		return len(v.modesTokensTypes[mode][state]) > 0
 	}
 	return false
 }
 
 func (v *Vocabulary) AllTokensTypesHasOption(state int, option *rule.RuleOption) bool {
-	if state < 0 || state >= len(v.transitionsTable) {
+	return v.AllTokensTypesHasOptionInMode(0, state, option)
+}
+
+func (v *Vocabulary) AllTokensTypesHasOptionInMode(mode int, state int, option *rule.RuleOption) bool {
+	if state < 0 || state >= len(v.modesTransitions[mode]) {
 		return false
 	}
-	for _, tokenType := range v.tokensTypes[state] {
+	for _, tokenType := range v.modesTokensTypes[mode][state] {
 		if v.tokensOptions[tokenType]&option.Code() == 0 {
 			return false
 		}
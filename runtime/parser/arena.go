@@ -0,0 +1,337 @@
+package parser
+
+import "iter"
+
+// noNode is the index of a missing node.
+const noNode = -1
+
+// nodesBlockBits gives the number of nodes of the blocks of an arena.
+const nodesBlockBits = 10
+
+// nodesBlockSize is the number of nodes of the blocks of an arena, which is also
+// the number of nodes that the parser keeps in streaming mode before dropping
+// the nodes already reported.
+const nodesBlockSize = 1 << nodesBlockBits
+
+// viewsBlockSize is the maximum number of views allocated at once by an arena.
+const viewsBlockSize = 1024
+
+// nodeRecord is a node of an arena, linked to the other nodes by their indexes.
+type nodeRecord struct {
+	ruleType   int32
+	startToken int32
+	endToken   int32
+	fullStart  int32
+	fullEnd    int32
+	parent     int32
+	sibling    int32
+	firstChild int32
+	token      bool
+}
+
+// nodeArena keeps the nodes of trees in blocks of records addressed by index.
+// The records have no pointers, so the garbage collector does not scan them,
+// and the parser works with the indexes only. The first block grows up to the
+// size of the others, so a small tree does not take a whole block. The ASTNode
+// of a record is a view created the first time it is asked for and kept by the
+// arena, so a node has always the same view. The values built for the nodes are
+// kept apart, only for the nodes that have one. The arena of a tree being
+// parsed is also addressed by the indexes kept by the parser, so its nodes can
+// not be moved to another arena until the parse ends.
+type nodeArena struct {
+	blocks     [][]nodeRecord
+	count      int
+	values     []any
+	views      []*ASTNode
+	viewsBlock []ASTNode
+	parsing    bool
+}
+
+func (a *nodeArena) len() int {
+	return a.count
+}
+
+func (a *nodeArena) node(id int32) *nodeRecord {
+	return &a.blocks[id>>nodesBlockBits][id&(nodesBlockSize-1)]
+}
+
+// add appends a copy of the node, returning its index. The blocks emptied by
+// truncate are used again.
+func (a *nodeArena) add(node *nodeRecord) int32 {
+	block := a.count >> nodesBlockBits
+	if block == len(a.blocks) {
+		capacity := nodesBlockSize
+		if block == 0 {
+			capacity = 0
+		}
+		a.blocks = append(a.blocks, make([]nodeRecord, 0, capacity))
+	}
+	a.blocks[block] = append(a.blocks[block], *node)
+	a.count++
+	return int32(a.count - 1)
+}
+
+func (a *nodeArena) newNode(ruleType int, start int, end int) int32 {
+	return a.add(&nodeRecord{
+		ruleType:   int32(ruleType),
+		startToken: int32(start),
+		endToken:   int32(end),
+		fullStart:  int32(start),
+		fullEnd:    int32(end),
+		parent:     noNode,
+		sibling:    noNode,
+		firstChild: noNode,
+	})
+}
+
+func (a *nodeArena) newTokenNode(ruleType int, tokenIndex int) int32 {
+	id := a.newNode(ruleType, tokenIndex, tokenIndex)
+	a.node(id).token = true
+	return id
+}
+
+// clone copies the node sharing its children. The children keep their parent,
+// since the node copied may still be used, and the parents of the nodes of the
+// tree returned by the parser are set when it is compacted.
+func (a *nodeArena) clone(id int32) int32 {
+	node := *a.node(id)
+	node.parent = noNode
+	node.sibling = noNode
+	clone := a.add(&node)
+	if value := a.value(id); value != nil {
+		a.setValue(clone, value)
+	}
+	return clone
+}
+
+func (a *nodeArena) sibling(id int32) int32 {
+	return a.node(id).sibling
+}
+
+func (a *nodeArena) setSibling(id int32, sibling int32) {
+	a.node(id).sibling = sibling
+}
+
+func (a *nodeArena) firstChild(id int32) int32 {
+	return a.node(id).firstChild
+}
+
+// setFirstChild sets the first child of the node, which becomes the parent of
+// the child and of all its siblings.
+func (a *nodeArena) setFirstChild(id int32, firstChild int32) {
+	a.node(id).firstChild = firstChild
+	for child := firstChild; child != noNode; child = a.node(child).sibling {
+		a.node(child).parent = id
+	}
+}
+
+func (a *nodeArena) value(id int32) any {
+	if int(id) < len(a.values) {
+		return a.values[id]
+	}
+	return nil
+}
+
+func (a *nodeArena) setValue(id int32, value any) {
+	for len(a.values) <= int(id) {
+		a.values = append(a.values, nil)
+	}
+	a.values[id] = value
+}
+
+// view returns the view of the node, or nil for a missing node.
+func (a *nodeArena) view(id int32) *ASTNode {
+	if id == noNode {
+		return nil
+	}
+	if int(id) < len(a.views) && a.views[id] != nil {
+		return a.views[id]
+	}
+	if len(a.viewsBlock) == cap(a.viewsBlock) {
+		a.viewsBlock = make([]ASTNode, 0, min(max(2*cap(a.viewsBlock), 16), viewsBlockSize))
+	}
+	a.viewsBlock = append(a.viewsBlock, ASTNode{arena: a, id: id})
+	view := &a.viewsBlock[len(a.viewsBlock)-1]
+	a.setView(id, view)
+	return view
+}
+
+func (a *nodeArena) setView(id int32, view *ASTNode) {
+	if int(id) >= len(a.views) {
+		a.views = append(a.views, make([]*ASTNode, a.count-len(a.views))...)
+	}
+	a.views[id] = view
+}
+
+// moveView gives the view of the node of this arena, if any, to the node of the
+// other arena.
+func (a *nodeArena) moveView(id int32, to *nodeArena, toId int32) {
+	if int(id) >= len(a.views) || a.views[id] == nil {
+		return
+	}
+	view := a.views[id]
+	a.views[id] = nil
+	view.arena = to
+	view.id = toId
+	to.setView(toId, view)
+}
+
+// traverse iterates over the node and its descendants in depth-first order,
+// yielding ENTER_NODE before the children of each node and EXIT_NODE after them.
+func (a *nodeArena) traverse(id int32) iter.Seq2[TraversalEvent, int32] {
+	return func(yield func(TraversalEvent, int32) bool) {
+		if !yield(ENTER_NODE, id) {
+			return
+		}
+		// the stack holds the entered nodes and the next child to enter of each one
+		nodes := []int32{id}
+		next := []int32{a.node(id).firstChild}
+		for len(nodes) > 0 {
+			top := len(nodes) - 1
+			if child := next[top]; child != noNode {
+				next[top] = a.node(child).sibling
+				if !yield(ENTER_NODE, child) {
+					return
+				}
+				nodes = append(nodes, child)
+				next = append(next, a.node(child).firstChild)
+				continue
+			}
+			if !yield(EXIT_NODE, nodes[top]) {
+				return
+			}
+			nodes = nodes[:top]
+			next = next[:top]
+		}
+	}
+}
+
+// compact copies the node and its descendants, in pre-order, to a new arena,
+// setting their parents, and moves their views and values to it. The nodes
+// discarded by the parser are left behind with the old arena.
+func (a *nodeArena) compact(root int32) *ASTNode {
+	count := 0
+	for event := range a.traverse(root) {
+		if event == ENTER_NODE {
+			count++
+		}
+	}
+	compacted := &nodeArena{count: count}
+	for first := 0; first < count; first += nodesBlockSize {
+		compacted.blocks = append(compacted.blocks, make([]nodeRecord, min(count-first, nodesBlockSize)))
+	}
+	newId := int32(0)
+	// the stack holds the parents of the nodes copied and the last child copied of each one
+	parents := make([]int32, 0)
+	last := make([]int32, 0)
+	for event, id := range a.traverse(root) {
+		if event == EXIT_NODE {
+			parents = parents[:len(parents)-1]
+			last = last[:len(last)-1]
+			continue
+		}
+		node := compacted.node(newId)
+		*node = *a.node(id)
+		node.parent = noNode
+		node.sibling = noNode
+		node.firstChild = noNode
+		if len(parents) > 0 {
+			node.parent = parents[len(parents)-1]
+			if prev := last[len(last)-1]; prev != noNode {
+				compacted.node(prev).sibling = newId
+			} else {
+				compacted.node(node.parent).firstChild = newId
+			}
+			last[len(last)-1] = newId
+		}
+		if value := a.value(id); value != nil {
+			compacted.setValue(newId, value)
+		}
+		a.moveView(id, compacted, newId)
+		parents = append(parents, newId)
+		last = append(last, noNode)
+		newId++
+	}
+	return compacted.view(0)
+}
+
+// truncate drops the nodes from the index on, keeping their blocks to be used
+// again. Their views are moved to a new arena, with copies of the nodes without
+// links, so they stay valid. The views created next are allocated from a new
+// block, so a block does not keep alive the views moved by different truncations.
+func (a *nodeArena) truncate(length int) {
+	count := 0
+	for id := length; id < len(a.views); id++ {
+		if a.views[id] != nil {
+			count++
+		}
+	}
+	dropped := &nodeArena{blocks: [][]nodeRecord{make([]nodeRecord, 0, min(count, nodesBlockSize))}}
+	for id := length; id < len(a.views); id++ {
+		if a.views[id] == nil {
+			continue
+		}
+		node := *a.node(int32(id))
+		node.parent = noNode
+		node.sibling = noNode
+		node.firstChild = noNode
+		newId := dropped.add(&node)
+		if value := a.value(int32(id)); value != nil {
+			dropped.setValue(newId, value)
+		}
+		a.moveView(int32(id), dropped, newId)
+	}
+	for block := length >> nodesBlockBits; block < len(a.blocks); block++ {
+		a.blocks[block] = a.blocks[block][:max(length-block<<nodesBlockBits, 0)]
+	}
+	a.count = length
+	if len(a.values) > length {
+		clear(a.values[length:])
+		a.values = a.values[:length]
+	}
+	if len(a.views) > length {
+		a.views = a.views[:length]
+	}
+	a.viewsBlock = nil
+}
+
+// merge moves the nodes of the smaller arena, with their values and views, to
+// the end of the larger one, which is returned, so nodes of different arenas
+// can be linked. The arena left is emptied, since all the views of its nodes
+// are moved. Arenas of trees being parsed can not be merged.
+func merge(a *nodeArena, b *nodeArena) *nodeArena {
+	if a == b {
+		return a
+	}
+	if a.parsing || b.parsing {
+		panic("nodes of a tree being parsed can not be linked to other trees")
+	}
+	if a.count < b.count {
+		a, b = b, a
+	}
+	offset := int32(a.count)
+	shift := func(id int32) int32 {
+		if id == noNode {
+			return noNode
+		}
+		return id + offset
+	}
+	for _, block := range b.blocks {
+		for _, node := range block {
+			node.parent = shift(node.parent)
+			node.sibling = shift(node.sibling)
+			node.firstChild = shift(node.firstChild)
+			a.add(&node)
+		}
+	}
+	for id, value := range b.values {
+		if value != nil {
+			a.setValue(int32(id)+offset, value)
+		}
+	}
+	for id := range b.views {
+		b.moveView(int32(id), a, int32(id)+offset)
+	}
+	*b = nodeArena{}
+	return a
+}
@@ -1,59 +1,309 @@
 package parser
 
-import "strings"
+import (
+	"iter"
+	"strings"
+)
 
+// ASTNode is a node of a tree. It is a view of a node kept by the arena of the
+// tree, so the nodes are not objects of their own in the heap. Nodes of different
+// trees linked together are moved to the same arena.
 type ASTNode struct {
-	ruleType   int
-	startToken int
-	endToken   int
-	sibling    *ASTNode
-	firstChild *ASTNode
+	arena *nodeArena
+	id    int32
 }
 
+// ERROR_RULE is the rule type of the nodes that cover the tokens skipped by error recovery.
+const ERROR_RULE = -2
+
 func NewASTNode(ruleType int, start int, end int) *ASTNode {
-	return &ASTNode{
-		ruleType:   ruleType,
-		startToken: start,
-		endToken:   end,
+	arena := &nodeArena{}
+	return arena.view(arena.newNode(ruleType, start, end))
+}
+
+// NewTokenNode creates the leaf of a concrete syntax tree for the token matched by the terminal rule.
+func NewTokenNode(ruleType int, tokenIndex int) *ASTNode {
+	arena := &nodeArena{}
+	return arena.view(arena.newTokenNode(ruleType, tokenIndex))
+}
+
+func (n *ASTNode) node() *nodeRecord {
+	return n.arena.node(n.id)
+}
+
+// link moves the nodes to the same arena, returning the index of the other node
+// in it, or noNode when it is nil.
+func (n *ASTNode) link(other *ASTNode) int32 {
+	if other == nil {
+		return noNode
 	}
+	merge(n.arena, other.arena)
+	return other.id
 }
 
 func (n *ASTNode) RuleType() int {
-	return n.ruleType
+	return int(n.node().ruleType)
+}
+
+func (n *ASTNode) IsError() bool {
+	return n.node().ruleType == ERROR_RULE
+}
+
+// IsToken reports whether the node is the leaf of a token in a concrete syntax tree.
+func (n *ASTNode) IsToken() bool {
+	return n.node().token
+}
+
+// Value returns the value built for the node by the builder of its rule.
+func (n *ASTNode) Value() any {
+	return n.arena.value(n.id)
 }
 
 func (n *ASTNode) StartToken() int {
-	return n.startToken
+	return int(n.node().startToken)
 }
 
 func (n *ASTNode) EndToken() int {
-	return n.endToken
+	return int(n.node().endToken)
+}
+
+// FullStartToken returns the index of the first token of the node including the
+// leading trivia. It is the start token when the tree is not a concrete syntax tree.
+func (n *ASTNode) FullStartToken() int {
+	return int(n.node().fullStart)
+}
+
+// FullEndToken returns the index of the last token of the node including the
+// trailing trivia. It is the end token when the tree is not a concrete syntax tree.
+func (n *ASTNode) FullEndToken() int {
+	return int(n.node().fullEnd)
 }
 
 func (n *ASTNode) Sibling() *ASTNode {
-	return n.sibling
+	return n.arena.view(n.node().sibling)
 }
 
+// SetSibling sets the next sibling of the node, which, with all its siblings,
+// gets the parent of the node.
 func (n *ASTNode) SetSibling(sibling *ASTNode) {
-	n.sibling = sibling
+	id := n.link(sibling)
+	arena := n.arena
+	arena.node(n.id).sibling = id
+	parent := arena.node(n.id).parent
+	for next := id; next != noNode; next = arena.node(next).sibling {
+		arena.node(next).parent = parent
+	}
 }
 
 func (n *ASTNode) FirstChild() *ASTNode {
-	return n.firstChild
+	return n.arena.view(n.node().firstChild)
 }
 
 func (n *ASTNode) Children() []*ASTNode {
 	children := make([]*ASTNode, 0)
-	child := n.firstChild
-	for child != nil {
-		children = append(children, child)
-		child = child.sibling
+	for child := n.node().firstChild; child != noNode; child = n.arena.node(child).sibling {
+		children = append(children, n.arena.view(child))
 	}
 	return children
 }
 
+// SetFirstChild sets the first child of the node, which becomes the parent of
+// the child and of all its siblings.
 func (n *ASTNode) SetFirstChild(firstChild *ASTNode) {
-	n.firstChild = firstChild
+	id := n.link(firstChild)
+	n.arena.setFirstChild(n.id, id)
+}
+
+// InsertChild inserts the child at the position among the children of the node,
+// detaching it from its parent first. A position equal to the number of children
+// appends it. It panics when the position is out of range or when the child is
+// the node or one of its ancestors.
+func (n *ASTNode) InsertChild(index int, child *ASTNode) {
+	id := n.link(child)
+	arena := n.arena
+	for ancestor := n.id; ancestor != noNode; ancestor = arena.node(ancestor).parent {
+		if ancestor == id {
+			panic("child is the node or one of its ancestors")
+		}
+	}
+	child.Detach()
+	if index == 0 {
+		arena.node(id).sibling = arena.node(n.id).firstChild
+		arena.node(n.id).firstChild = id
+	} else {
+		prev := arena.node(n.id).firstChild
+		for i := 1; i < index && prev != noNode; i++ {
+			prev = arena.node(prev).sibling
+		}
+		if index < 0 || prev == noNode {
+			panic("child index out of range")
+		}
+		arena.node(id).sibling = arena.node(prev).sibling
+		arena.node(prev).sibling = id
+	}
+	arena.node(id).parent = n.id
+}
+
+// Detach removes the node, with all its descendants, from the children of its parent.
+func (n *ASTNode) Detach() {
+	arena := n.arena
+	parent := arena.node(n.id).parent
+	if parent == noNode {
+		return
+	}
+	if prev := n.prevSibling(); prev != noNode {
+		arena.node(prev).sibling = arena.node(n.id).sibling
+	} else {
+		arena.node(parent).firstChild = arena.node(n.id).sibling
+	}
+	arena.node(n.id).parent = noNode
+	arena.node(n.id).sibling = noNode
+}
+
+// ReplaceWith puts the node in the place of this node among the children of its parent.
+func (n *ASTNode) ReplaceWith(node *ASTNode) {
+	if n.node().parent == noNode {
+		return
+	}
+	id := n.link(node)
+	arena := n.arena
+	parent := arena.node(n.id).parent
+	if prev := n.prevSibling(); prev != noNode {
+		arena.node(prev).sibling = id
+	} else {
+		arena.node(parent).firstChild = id
+	}
+	arena.node(id).parent = parent
+	arena.node(id).sibling = arena.node(n.id).sibling
+	arena.node(n.id).parent = noNode
+	arena.node(n.id).sibling = noNode
+}
+
+// Wrap puts a new node of the rule type, covering the same tokens, in the place
+// of this node, which becomes its only child.
+func (n *ASTNode) Wrap(ruleType int) *ASTNode {
+	id := n.arena.newNode(ruleType, n.StartToken(), n.EndToken())
+	wrapper := n.arena.view(id)
+	wrapper.node().fullStart = n.node().fullStart
+	wrapper.node().fullEnd = n.node().fullEnd
+	n.ReplaceWith(wrapper)
+	wrapper.SetFirstChild(n)
+	return wrapper
+}
+
+func (n *ASTNode) Parent() *ASTNode {
+	return n.arena.view(n.node().parent)
+}
+
+func (n *ASTNode) PrevSibling() *ASTNode {
+	return n.arena.view(n.prevSibling())
+}
+
+func (n *ASTNode) prevSibling() int32 {
+	arena := n.arena
+	parent := arena.node(n.id).parent
+	if parent == noNode {
+		return noNode
+	}
+	prev := int32(noNode)
+	for child := arena.node(parent).firstChild; child != noNode && child != n.id; child = arena.node(child).sibling {
+		prev = child
+	}
+	return prev
+}
+
+func (n *ASTNode) LastChild() *ASTNode {
+	arena := n.arena
+	child := arena.node(n.id).firstChild
+	for child != noNode && arena.node(child).sibling != noNode {
+		child = arena.node(child).sibling
+	}
+	return n.arena.view(child)
+}
+
+// ChildIndex returns the position of the node among the children of its parent,
+// or -1 when the node has no parent.
+func (n *ASTNode) ChildIndex() int {
+	arena := n.arena
+	parent := arena.node(n.id).parent
+	if parent == noNode {
+		return -1
+	}
+	index := 0
+	for child := arena.node(parent).firstChild; child != noNode && child != n.id; child = arena.node(child).sibling {
+		index++
+	}
+	return index
+}
+
+// Depth returns the number of ancestors of the node.
+func (n *ASTNode) Depth() int {
+	depth := 0
+	for parent := n.node().parent; parent != noNode; parent = n.arena.node(parent).parent {
+		depth++
+	}
+	return depth
+}
+
+// ChildNodes iterates over the children of the node.
+func (n *ASTNode) ChildNodes() iter.Seq[*ASTNode] {
+	return func(yield func(*ASTNode) bool) {
+		for child := n.FirstChild(); child != nil; child = child.Sibling() {
+			if !yield(child) {
+				return
+			}
+		}
+	}
+}
+
+// Ancestors iterates over the ancestors of the node, from its parent up to the root.
+func (n *ASTNode) Ancestors() iter.Seq[*ASTNode] {
+	return func(yield func(*ASTNode) bool) {
+		for parent := n.Parent(); parent != nil; parent = parent.Parent() {
+			if !yield(parent) {
+				return
+			}
+		}
+	}
+}
+
+// Descendants iterates over the descendants of the node in pre-order.
+func (n *ASTNode) Descendants() iter.Seq[*ASTNode] {
+	return func(yield func(*ASTNode) bool) {
+		for node := range n.PreOrder() {
+			if node != n && !yield(node) {
+				return
+			}
+		}
+	}
+}
+
+// Covers reports whether the token index is inside the tokens of the node.
+func (n *ASTNode) Covers(tokenIndex int) bool {
+	node := n.node()
+	return tokenIndex >= int(node.startToken) && tokenIndex <= int(node.endToken)
+}
+
+// NodeAtToken returns the deepest node, starting at this node, that covers the
+// token index, or nil when the node does not cover it.
+func (n *ASTNode) NodeAtToken(tokenIndex int) *ASTNode {
+	if !n.Covers(tokenIndex) {
+		return nil
+	}
+	node := n
+	for {
+		var covering *ASTNode
+		for child := node.FirstChild(); child != nil; child = child.Sibling() {
+			if child.Covers(tokenIndex) {
+				covering = child
+				break
+			}
+		}
+		if covering == nil {
+			return node
+		}
+		node = covering
+	}
 }
 
 func (n *ASTNode) Find(syntax *Syntax, pathToNode string) *ASTNode {
@@ -64,16 +314,16 @@ func (n *ASTNode) findNode(syntax *Syntax, rulesNames []string) *ASTNode {
 	if len(rulesNames) == 0 {
 		return nil
 	}
-	child := n.firstChild
+	child := n.FirstChild()
 	for child != nil {
-		if strings.EqualFold(syntax.RuleName(child.ruleType), rulesNames[0]) {
+		if strings.EqualFold(syntax.RuleName(child.RuleType()), rulesNames[0]) {
 			if len(rulesNames) == 1 {
 				return child
 			} else {
 				return child.findNode(syntax, rulesNames[1:])
 			}
 		}
-		child = child.sibling
+		child = child.Sibling()
 	}
 	return nil
 }
@@ -96,12 +346,12 @@ func (n *ASTNode) List(syntax *Syntax, pathToNode string) []*ASTNode {
 		ruleName = rulesNames[0]
 	}
 	subnodes := make([]*ASTNode, 0)
-	child := startNode.firstChild
+	child := startNode.FirstChild()
 	for child != nil {
-		if strings.EqualFold(syntax.RuleName(child.ruleType), ruleName) {
+		if strings.EqualFold(syntax.RuleName(child.RuleType()), ruleName) {
 			subnodes = append(subnodes, child)
 		}
-		child = child.sibling
+		child = child.Sibling()
 	}
 	return subnodes
 }
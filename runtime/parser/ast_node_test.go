@@ -0,0 +1,218 @@
+package parser_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// navigationSource has the tokens a(0) =(2) 1(4) +(6) b(8) ;(9) c(11) =(13) 2(15)
+// ;(16) and EOI(17), with the ignored tokens between them.
+const navigationSource = "a = 1 + b;\n  c = 2;"
+
+// ruleNames returns the rule names of the nodes.
+func ruleNames(p *parser.Parser, nodes ...*parser.ASTNode) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node == nil {
+			names = append(names, "nil")
+		} else {
+			names = append(names, p.Syntax().RuleName(node.RuleType())+" "+p.NodeText(node))
+		}
+	}
+	return names
+}
+
+func TestNavigation(t *testing.T) {
+	p := newParser(t, streamGrammar, navigationSource)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	first, second := root.FirstChild(), root.LastChild()
+	expr := first.FirstChild()
+	term := expr.LastChild()
+	tests := []struct {
+		name string
+		got  []*parser.ASTNode
+		want []string
+	}{
+		{name: "children", got: root.Children(), want: []string{"Stmt a = 1 + b;", "Stmt c = 2;"}},
+		{name: "parents", got: []*parser.ASTNode{root.Parent(), first.Parent(), term.Parent()}, want: []string{"nil", "Program " + navigationSource, "Expr 1 + b"}},
+		{name: "siblings", got: []*parser.ASTNode{first.Sibling(), second.Sibling(), second.PrevSibling(), first.PrevSibling()}, want: []string{"Stmt c = 2;", "nil", "Stmt a = 1 + b;", "nil"}},
+		{name: "last child", got: []*parser.ASTNode{expr.LastChild(), term.LastChild()}, want: []string{"Term b", "nil"}},
+		{name: "node at token", got: []*parser.ASTNode{root.NodeAtToken(8), root.NodeAtToken(6), root.NodeAtToken(10), root.NodeAtToken(15), first.NodeAtToken(15)}, want: []string{"Term b", "Expr 1 + b", "Program " + navigationSource, "Term 2", "nil"}},
+		{name: "node at position", got: []*parser.ASTNode{p.NodeAt(root, 1, 9), p.NodeAt(root, 2, 7), p.NodeAt(root, 1, 1), p.NodeAt(root, 0, 1)}, want: []string{"Term b", "Term 2", "Stmt a = 1 + b;", "nil"}},
+	}
+	for _, test := range tests {
+		if got := ruleNames(p, test.got...); !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+	if first.ChildIndex() != 0 || second.ChildIndex() != 1 || term.ChildIndex() != 1 || root.ChildIndex() != -1 {
+		t.Errorf("got child indexes %d %d %d %d, want 0 1 1 -1", first.ChildIndex(), second.ChildIndex(), term.ChildIndex(), root.ChildIndex())
+	}
+	if root.Depth() != 0 || expr.Depth() != 2 || term.Depth() != 3 {
+		t.Errorf("got depths %d %d %d, want 0 2 3", root.Depth(), expr.Depth(), term.Depth())
+	}
+	if !expr.Covers(4) || !expr.Covers(8) || expr.Covers(9) || expr.Covers(3) {
+		t.Errorf("Expr covers the tokens %d-%d, want 4-8", expr.StartToken(), expr.EndToken())
+	}
+}
+
+func TestTokenIndexAt(t *testing.T) {
+	tests := []struct {
+		row, col, want int
+	}{
+		{row: 1, col: 1, want: 0},
+		{row: 1, col: 5, want: 4},
+		{row: 1, col: 6, want: 5},
+		{row: 1, col: 10, want: 9},
+		{row: 2, col: 1, want: 10},
+		{row: 2, col: 3, want: 11},
+		{row: 2, col: 20, want: 17},
+		{row: 0, col: 5, want: -1},
+	}
+	p := newParser(t, streamGrammar, navigationSource)
+	if p.Execute() == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	for _, test := range tests {
+		if got := p.TokenIndexAt(test.row, test.col); got != test.want {
+			t.Errorf("%d:%d: got token %d, want %d", test.row, test.col, got, test.want)
+		}
+	}
+	if errors := p.Lexer().Errors(); len(errors) > 0 {
+		t.Errorf("got lexer errors %v", errors)
+	}
+}
+
+func TestTreeChanges(t *testing.T) {
+	p := newParser(t, streamGrammar, navigationSource)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	first, second := root.FirstChild(), root.LastChild()
+	expr := first.FirstChild()
+	leftTerm, rightTerm := expr.FirstChild(), expr.LastChild()
+
+	// a node inserted is detached from its parent first
+	second.InsertChild(0, rightTerm)
+	if got := ruleNames(p, expr.Children()...); !slices.Equal(got, []string{"Term 1"}) {
+		t.Errorf("got children %q of the old parent", got)
+	}
+	if rightTerm.Parent() != second || rightTerm.ChildIndex() != 0 || second.FirstChild().Sibling().RuleType() != expr.RuleType() {
+		t.Errorf("got parent %q at %d", ruleNames(p, rightTerm.Parent()), rightTerm.ChildIndex())
+	}
+
+	// the siblings set get the parent of the node
+	rightTerm.Detach()
+	leftTerm.SetSibling(rightTerm)
+	if rightTerm.Parent() != expr || rightTerm.ChildIndex() != 1 || rightTerm.PrevSibling() != leftTerm {
+		t.Errorf("got parent %q at %d after setting the sibling", ruleNames(p, rightTerm.Parent()), rightTerm.ChildIndex())
+	}
+	rightTerm.Detach()
+	if rightTerm.Parent() != nil || expr.LastChild() != leftTerm {
+		t.Errorf("got parent %q after detaching", ruleNames(p, rightTerm.Parent()))
+	}
+
+	wrapper := leftTerm.Wrap(root.RuleType())
+	if wrapper.Parent() != expr || leftTerm.Parent() != wrapper || wrapper.StartToken() != leftTerm.StartToken() {
+		t.Errorf("got wrapper under %q", ruleNames(p, wrapper.Parent()))
+	}
+	wrapper.ReplaceWith(rightTerm)
+	if rightTerm.Parent() != expr || wrapper.Parent() != nil || expr.FirstChild() != rightTerm {
+		t.Errorf("got parent %q after replacing", ruleNames(p, rightTerm.Parent()))
+	}
+
+	for _, ancestor := range []*parser.ASTNode{first, expr, root} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("inserting %q under its descendant did not panic", ruleNames(p, ancestor))
+				}
+			}()
+			rightTerm.InsertChild(0, ancestor)
+		}()
+	}
+}
+
+// TestLinkTrees checks that the nodes of two trees parsed apart can be read
+// after a node of one tree is inserted in the other, whichever tree is larger.
+func TestLinkTrees(t *testing.T) {
+	sources := [][2]string{{"[1 [2]]! [3];", "[4]."}, {"[4].", "[1 [2]]! [3];"}}
+	for _, source := range sources {
+		first := newParser(t, memoGrammar, source[0])
+		firstRoot := first.Execute()
+		second := newParser(t, memoGrammar, source[1])
+		secondRoot := second.Execute()
+		if firstRoot == nil || secondRoot == nil {
+			t.Fatalf("parse failed: %v %v", first.Errors(), second.Errors())
+		}
+		firstNodes := descendants(firstRoot)
+		secondNodes := descendants(secondRoot)
+		moved := secondRoot.FirstChild()
+		moved.Detach()
+		firstRoot.InsertChild(0, moved)
+		if moved.Parent() != firstRoot || firstRoot.FirstChild() != moved {
+			t.Errorf("%v: node not inserted", source)
+		}
+		for _, node := range append(firstNodes, secondNodes...) {
+			if node != firstRoot && node != secondRoot && node.Parent() == nil {
+				t.Errorf("%v: node %d of %d-%d lost its parent", source, node.RuleType(), node.StartToken(), node.EndToken())
+			}
+			for child := range node.ChildNodes() {
+				if child.Parent() != node {
+					t.Errorf("%v: child %d-%d has another parent", source, child.StartToken(), child.EndToken())
+				}
+			}
+		}
+		if got := len(descendants(firstRoot)); got != len(firstNodes)+len(descendants(moved))+1 {
+			t.Errorf("%v: got %d nodes after inserting", source, got)
+		}
+	}
+}
+
+// descendants returns the nodes under the node.
+func descendants(node *parser.ASTNode) []*parser.ASTNode {
+	nodes := make([]*parser.ASTNode, 0)
+	for descendant := range node.Descendants() {
+		nodes = append(nodes, descendant)
+	}
+	return nodes
+}
+
+// linkListener inserts the first node reported in another tree, recording
+// whether the parser refused it.
+type linkListener struct {
+	other   *parser.ASTNode
+	refused bool
+}
+
+func (l *linkListener) EnterRule(p *parser.Parser, ruleId int) {
+}
+
+func (l *linkListener) ExitRule(p *parser.Parser, node *parser.ASTNode) {
+	if l.other.FirstChild() != nil || l.refused {
+		return
+	}
+	defer func() { l.refused = recover() != nil }()
+	l.other.InsertChild(0, node)
+}
+
+func (l *linkListener) Token(p *parser.Parser, tokenIndex int) {
+}
+
+func TestLinkWhileParsing(t *testing.T) {
+	p := newParser(t, streamGrammar, statements(3))
+	listener := &linkListener{other: parser.NewASTNode(0, 0, 0)}
+	p.SetListener(listener)
+	if p.Execute() == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	if !listener.refused || listener.other.FirstChild() != nil {
+		t.Errorf("a node of the tree being parsed was linked to another tree")
+	}
+}
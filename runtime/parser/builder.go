@@ -0,0 +1,92 @@
+package parser
+
+import "fmt"
+
+// Builder builds the value of a node when its rule matches, from the values of
+// its children. The value of a child without a builder is its text when it is a
+// leaf, otherwise the values of its own children take its place. The tokens not
+// ignored that the rule matches outside its children, which are leaves only in
+// a concrete syntax tree, give their texts in their place in any mode. Error
+// nodes have no value. The values built for a match discarded by backtracking are
+// discarded with its nodes, and the value of the whole parse is the value of
+// the root node returned by Execute.
+type Builder func(p *Parser, node *ASTNode, values []any) any
+
+// SetBuilder sets the builder of the rule, or removes it when the builder is nil.
+// In streaming mode the children reported before the end of a rule are not kept,
+// so builders must not be used with a listener.
+func (p *Parser) SetBuilder(ruleId int, builder Builder) error {
+	if ruleId < 0 || ruleId >= p.syntax.RulesCount() {
+		return fmt.Errorf("rule id %d not found", ruleId)
+	}
+	if p.builders == nil {
+		p.builders = make([]Builder, p.syntax.RulesCount())
+	}
+	p.builders[ruleId] = builder
+	return nil
+}
+
+func (p *Parser) SetBuilderName(ruleName string, builder Builder) error {
+	ruleId := p.syntax.RuleId(ruleName)
+	if ruleId < 0 {
+		return fmt.Errorf("rule '%s' not found", ruleName)
+	}
+	return p.SetBuilder(ruleId, builder)
+}
+
+func (p *Parser) buildValue(node int32) {
+	if builder := p.builders[p.arena.node(node).ruleType]; builder != nil {
+		values := p.appendChildrenValues(make([]any, 0), node)
+		p.arena.setValue(node, builder(p, p.arena.view(node), values))
+	}
+}
+
+func (p *Parser) appendValues(values []any, node int32) []any {
+	n := p.arena.node(node)
+	switch {
+	case n.ruleType == ERROR_RULE:
+		return values
+	case p.builders[n.ruleType] != nil:
+		return append(values, p.arena.value(node))
+	case n.firstChild == noNode:
+		if n.endToken < n.startToken {
+			return append(values, "")
+		}
+		return append(values, p.tokensText(int(n.startToken), int(n.endToken)))
+	}
+	return p.appendChildrenValues(values, node)
+}
+
+// appendChildrenValues appends the values of the children of the node. Without a
+// concrete syntax tree the tokens matched between the children have no nodes, so
+// their texts are appended in their place.
+func (p *Parser) appendChildrenValues(values []any, node int32) []any {
+	arena := p.arena
+	index := int(arena.node(node).startToken)
+	for child := arena.node(node).firstChild; child != noNode; child = arena.node(child).sibling {
+		if !p.cst {
+			values = p.appendTokensTexts(values, index, int(arena.node(child).startToken)-1)
+		}
+		values = p.appendValues(values, child)
+		index = max(index, int(arena.node(child).endToken)+1)
+	}
+	if !p.cst {
+		values = p.appendTokensTexts(values, index, int(arena.node(node).endToken))
+	}
+	return values
+}
+
+// appendTokensTexts appends the texts of the tokens not ignored from the start
+// to the end token index.
+func (p *Parser) appendTokensTexts(values []any, start int, end int) []any {
+	for index := start; index <= end; index++ {
+		tkn, err := p.lexer.Token(index)
+		if err != nil {
+			break
+		}
+		if !p.lexer.IsIgnored(tkn) {
+			values = append(values, p.lexer.Input().GetText(tkn.Index(), tkn.Index()+tkn.Len()))
+		}
+	}
+	return values
+}
@@ -0,0 +1,50 @@
+package parser_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const sumGrammar = `grammar Sum;
+
+Sum : Prim ('+' Prim)* EOI;
+
+Prim : Number | Ident | '(' Sum2 ')';
+
+Sum2 : Prim ('+' Prim)*;
+
+Number : [0-9]+;
+
+Ident : [a-z]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+func TestBuilderValues(t *testing.T) {
+	for _, cst := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cst=%v", cst), func(t *testing.T) {
+			p := newParser(t, sumGrammar, "1 + x + (2 + y)")
+			p.SetCST(cst)
+			show := func(p *parser.Parser, node *parser.ASTNode, values []any) any {
+				return fmt.Sprint(values)
+			}
+			for _, name := range []string{"Sum", "Prim", "Sum2"} {
+				if err := p.SetBuilderName(name, show); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root := p.Execute()
+			if root == nil {
+				t.Fatalf("parse failed: %v", p.Errors())
+			}
+			// the end of input matched by Sum gives an empty text
+			want := "[[1] + [x] + [( [[2] + [y]] )] ]"
+			if got := root.Value(); got != want {
+				t.Errorf("got value %v, want %v", got, want)
+			}
+		})
+	}
+}
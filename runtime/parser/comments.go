@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/lexer"
+)
+
+// nodeComments are the tokens of a channel attached to a node.
+type nodeComments struct {
+	leading  []*lexer.Token
+	trailing []*lexer.Token
+}
+
+// AttachComments attaches the tokens of the channel, like comments, to the
+// nearest nodes of the tree under the root. A token on the same line after the
+// last token of a node is a trailing comment of the outermost node ending at
+// that token. The other tokens are leading comments of the outermost node
+// starting at the next token seen by the parser, so a doc comment belongs to the
+// declaration below it. The comments that no other node takes are attached to
+// the root.
+func (p *Parser) AttachComments(root *ASTNode, channel string) {
+	channelIndex := p.lexer.Vocabulary().ChannelIndex(channel)
+	if root == nil || channelIndex < 0 {
+		return
+	}
+	if p.comments == nil {
+		p.comments = make(map[*ASTNode]*nodeComments)
+	}
+	tokens := p.lexer.Tokens()
+	// the first token kept by the lexer has the index of the tokens released
+	offset := p.lexer.Released()
+	nexts := make([]int, len(tokens))
+	next := -1
+	for i := len(tokens) - 1; i >= 0; i-- {
+		nexts[i] = next
+		if !p.lexer.IsIgnored(tokens[i]) && !tokens[i].IsType(lexer.TKN_EOF) {
+			next = i
+		}
+	}
+	prev := -1
+	for i, tkn := range tokens {
+		if p.lexer.TokenChannel(tkn) != channelIndex {
+			if !p.lexer.IsIgnored(tkn) {
+				prev = i
+			}
+			continue
+		}
+		if prev >= 0 && !p.lineBreakBetween(tokens[prev], tkn) {
+			if node := outermostEndingAt(root, offset+prev); node != nil {
+				p.nodeComments(node).trailing = append(p.nodeComments(node).trailing, tkn)
+				continue
+			}
+		}
+		if nexts[i] >= 0 {
+			if node := outermostStartingAt(root, offset+nexts[i]); node != nil {
+				p.nodeComments(node).leading = append(p.nodeComments(node).leading, tkn)
+				continue
+			}
+		}
+		if prev >= 0 {
+			if node := outermostEndingAt(root, offset+prev); node != nil {
+				p.nodeComments(node).trailing = append(p.nodeComments(node).trailing, tkn)
+				continue
+			}
+		}
+		p.nodeComments(root).leading = append(p.nodeComments(root).leading, tkn)
+	}
+}
+
+// LeadingComments returns the comments attached before the node by AttachComments.
+func (p *Parser) LeadingComments(node *ASTNode) []*lexer.Token {
+	if comments, found := p.comments[node]; found {
+		return comments.leading
+	}
+	return nil
+}
+
+// TrailingComments returns the comments attached after the node by AttachComments.
+func (p *Parser) TrailingComments(node *ASTNode) []*lexer.Token {
+	if comments, found := p.comments[node]; found {
+		return comments.trailing
+	}
+	return nil
+}
+
+func (p *Parser) nodeComments(node *ASTNode) *nodeComments {
+	comments, found := p.comments[node]
+	if !found {
+		comments = &nodeComments{}
+		p.comments[node] = comments
+	}
+	return comments
+}
+
+func (p *Parser) lineBreakBetween(first *lexer.Token, second *lexer.Token) bool {
+	return strings.Contains(p.lexer.Input().GetText(first.Index()+first.Len(), second.Index()), "\n")
+}
+
+// outermostStartingAt returns the outermost node under the root whose first token
+// is at the index, or nil when no node starts there.
+func outermostStartingAt(root *ASTNode, tokenIndex int) *ASTNode {
+	return outermostAt(root, tokenIndex, func(node *ASTNode) bool { return node.StartToken() == tokenIndex })
+}
+
+// outermostEndingAt returns the outermost node under the root whose last token is
+// at the index, or nil when no node ends there.
+func outermostEndingAt(root *ASTNode, tokenIndex int) *ASTNode {
+	return outermostAt(root, tokenIndex, func(node *ASTNode) bool { return node.EndToken() == tokenIndex })
+}
+
+func outermostAt(root *ASTNode, tokenIndex int, isAt func(node *ASTNode) bool) *ASTNode {
+	node := root
+	for {
+		var covering *ASTNode
+		for child := node.FirstChild(); child != nil; child = child.Sibling() {
+			if child.Covers(tokenIndex) {
+				covering = child
+				break
+			}
+		}
+		if covering == nil || isAt(covering) {
+			return covering
+		}
+		node = covering
+	}
+}
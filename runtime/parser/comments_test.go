@@ -0,0 +1,104 @@
+package parser_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const commentsGrammar = `grammar Comments;
+
+Program : Stmt* EOI;
+
+Stmt : Ident '=' Number ';';
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+@Channel(comments)
+Comment : '#' ('\n')!*;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+const commentsSource = `# first
+a = 1; # after a
+# before b
+b = 2;
+# last`
+
+// tokensTexts returns the texts of the tokens.
+func tokensTexts(p *parser.Parser, tokens []*lexer.Token) []string {
+	texts := make([]string, 0, len(tokens))
+	for _, tkn := range tokens {
+		texts = append(texts, p.Lexer().Input().GetText(tkn.Index(), tkn.Index()+tkn.Len()))
+	}
+	return texts
+}
+
+func TestTokensOnChannel(t *testing.T) {
+	p := newParser(t, commentsGrammar, commentsSource)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	if len(root.Children()) != 2 {
+		t.Errorf("got %d statements, want 2", len(root.Children()))
+	}
+	want := []string{"# first", "# after a", "# before b", "# last"}
+	if got := tokensTexts(p, p.Lexer().TokensOnChannel("comments")); !slices.Equal(got, want) {
+		t.Errorf("got comments %q, want %q", got, want)
+	}
+	if got := p.Lexer().TokensOnChannel("other"); got != nil {
+		t.Errorf("got tokens %v on an unknown channel", got)
+	}
+	if errors := p.Lexer().Errors(); len(errors) > 0 {
+		t.Errorf("got lexer errors %v", errors)
+	}
+}
+
+func TestAttachComments(t *testing.T) {
+	tests := []struct {
+		name    string
+		release int
+	}{
+		{name: "all tokens"},
+		{name: "released tokens", release: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, commentsGrammar, commentsSource)
+			root := p.Execute()
+			if root == nil {
+				t.Fatalf("parse failed: %v", p.Errors())
+			}
+			p.Lexer().Release(test.release)
+			p.AttachComments(root, "comments")
+			first, second := root.FirstChild(), root.LastChild()
+			if got := tokensTexts(p, p.TrailingComments(first)); !slices.Equal(got, []string{"# after a"}) {
+				t.Errorf("got trailing comments %q of a", got)
+			}
+			if got := tokensTexts(p, p.LeadingComments(second)); !slices.Equal(got, []string{"# before b"}) {
+				t.Errorf("got leading comments %q of b", got)
+			}
+			// no statement follows the last comment
+			if got := tokensTexts(p, p.TrailingComments(second)); !slices.Equal(got, []string{"# last"}) {
+				t.Errorf("got trailing comments %q of b", got)
+			}
+			want := []string{"# first"}
+			if test.release > 0 {
+				want = want[1:]
+			}
+			if got := tokensTexts(p, p.LeadingComments(first)); !slices.Equal(got, want) {
+				t.Errorf("got leading comments %q of a, want %q", got, want)
+			}
+			if errors := p.Lexer().Errors(); len(errors) > 0 {
+				t.Errorf("got lexer errors %v", errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/lexer"
+)
+
+// SetCST enables the concrete syntax tree mode. Every token matched by a terminal
+// rule becomes a leaf node and the tokens between the leaves, like spaces and
+// comments, are attached to them as leading and trailing trivia, so the text of
+// the input can be printed back from the tree.
+func (p *Parser) SetCST(cst bool) {
+	p.cst = cst
+}
+
+func (p *Parser) CST() bool {
+	return p.cst
+}
+
+// LeadingTrivia returns the tokens before the token of the leaf that belong to it.
+func (p *Parser) LeadingTrivia(leaf *ASTNode) []*lexer.Token {
+	return p.tokensRange(leaf.FullStartToken(), leaf.StartToken()-1)
+}
+
+// TrailingTrivia returns the tokens after the token of the leaf that belong to it.
+func (p *Parser) TrailingTrivia(leaf *ASTNode) []*lexer.Token {
+	return p.tokensRange(leaf.EndToken()+1, leaf.FullEndToken())
+}
+
+// FullText returns the text of the node including its trivia. The full text of
+// the root of a concrete syntax tree is the whole input.
+func (p *Parser) FullText(node *ASTNode) string {
+	if node.FullEndToken() < node.FullStartToken() {
+		return ""
+	}
+	return p.tokensText(node.FullStartToken(), node.FullEndToken())
+}
+
+func (p *Parser) tokensRange(start int, end int) []*lexer.Token {
+	tokens := make([]*lexer.Token, 0, max(end-start+1, 0))
+	for index := start; index <= end; index++ {
+		tkn, err := p.lexer.Token(index)
+		if err != nil {
+			break
+		}
+		tokens = append(tokens, tkn)
+	}
+	return tokens
+}
+
+func (p *Parser) createTokenNode(ruleId int, lastNode int32) {
+	node := p.arena.newTokenNode(ruleId, p.lexer.Index()-1)
+	p.countNode()
+	p.arena.setSibling(lastNode, node)
+	if p.builders != nil {
+		p.buildValue(node)
+	}
+	p.currentNode = node
+}
+
+// attachTrivia gives to each leaf the tokens between it and the previous leaf.
+// The ignored tokens after a leaf up to the end of its line are its trailing
+// trivia and the other ones are the leading trivia of the next leaf. Tokens
+// skipped by the error recovery are leading trivia too.
+func (p *Parser) attachTrivia(root *ASTNode) {
+	index := p.lexer.Index()
+	tokens := p.lexer.Tokens()
+	p.lexer.SetIndex(index)
+	lastIndex := p.lexer.Released() + len(tokens) - 1
+	if last := len(tokens) - 1; last >= 0 && tokens[last].IsType(lexer.TKN_EOF) && tokens[last].Len() == 0 {
+		lastIndex--
+	}
+	arena := root.arena
+	leaves := make([]int32, 0)
+	for event, node := range arena.traverse(root.id) {
+		if event == ENTER_NODE && arena.node(node).token {
+			leaves = append(leaves, node)
+		}
+	}
+	if len(leaves) == 0 {
+		return
+	}
+	next := 0
+	for i, id := range leaves {
+		leaf := arena.node(id)
+		leaf.fullStart = int32(min(next, int(leaf.startToken)))
+		if i == len(leaves)-1 {
+			leaf.fullEnd = int32(max(lastIndex, int(leaf.endToken)))
+		} else {
+			leaf.fullEnd = int32(p.trailingEnd(int(leaf.endToken), int(arena.node(leaves[i+1]).startToken)))
+		}
+		next = int(leaf.fullEnd) + 1
+	}
+	setFullRange(arena, root.id)
+}
+
+func (p *Parser) trailingEnd(end int, nextLeaf int) int {
+	for index := end + 1; index < nextLeaf; index++ {
+		tkn, err := p.lexer.Token(index)
+		if err != nil || !p.lexer.IsIgnored(tkn) {
+			return index - 1
+		}
+		if strings.Contains(p.lexer.Input().GetText(tkn.Index(), tkn.Index()+tkn.Len()), "\n") {
+			return index
+		}
+	}
+	return nextLeaf - 1
+}
+
+// setFullRange sets the full range of the node and of its descendants after
+// the ranges of the leaves.
+func setFullRange(arena *nodeArena, root int32) {
+	for event, id := range arena.traverse(root) {
+		node := arena.node(id)
+		if event == ENTER_NODE || node.firstChild == noNode {
+			continue
+		}
+		last := node.firstChild
+		for child := node.firstChild; child != noNode; child = arena.node(child).sibling {
+			last = child
+		}
+		node.fullStart = min(arena.node(node.firstChild).fullStart, node.startToken)
+		node.fullEnd = max(arena.node(last).fullEnd, node.endToken)
+	}
+}
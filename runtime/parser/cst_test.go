@@ -0,0 +1,54 @@
+package parser_test
+
+import "testing"
+
+func TestCSTFullText(t *testing.T) {
+	sources := []string{"a = 1;", "  a = b + 1 ;\n\tb=2;  \n", "x = 1;\n\n"}
+	for _, source := range sources {
+		p := newParser(t, streamGrammar, source)
+		p.SetCST(true)
+		root := p.Execute()
+		if root == nil {
+			t.Fatalf("%q: parse failed: %v", source, p.Errors())
+		}
+		if got := p.FullText(root); got != source {
+			t.Errorf("got full text %q, want %q", got, source)
+		}
+		if errors := p.Lexer().Errors(); len(errors) > 0 {
+			t.Errorf("%q: got lexer errors %v", source, errors)
+		}
+	}
+}
+
+func TestCSTTrivia(t *testing.T) {
+	p := newParser(t, streamGrammar, "a = 1 ;\n  b = 2;")
+	p.SetCST(true)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	texts := make([]string, 0)
+	for node := range root.Descendants() {
+		if !node.IsToken() {
+			continue
+		}
+		leading, trailing := "", ""
+		for _, tkn := range p.LeadingTrivia(node) {
+			leading += p.Lexer().Input().GetText(tkn.Index(), tkn.Index()+tkn.Len())
+		}
+		for _, tkn := range p.TrailingTrivia(node) {
+			trailing += p.Lexer().Input().GetText(tkn.Index(), tkn.Index()+tkn.Len())
+		}
+		texts = append(texts, "["+leading+"]"+p.NodeText(node)+"["+trailing+"]")
+	}
+	// the spaces up to the next line are one token, trailing the end of the line
+	want := []string{"[]a[ ]", "[]=[ ]", "[]1[ ]", "[];[\n  ]", "[]b[ ]", "[]=[ ]", "[]2[]", "[];[]", "[][]"}
+	if len(texts) != len(want) {
+		t.Fatalf("got leaves %q, want %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("got leaf %q, want %q", texts[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const identsGrammar = `grammar Idents;
+
+Program : Name* EOI;
+
+Name : Ident;
+
+Ident : [a-z]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+func TestErrorTypeAfterTokens(t *testing.T) {
+	v := newParser(t, identsGrammar, "").Lexer().Vocabulary()
+	names := v.TokensNames()
+	if v.ErrorType() != len(names)-1 || names[v.ErrorType()] != "ERROR" {
+		t.Errorf("got error type %d in %v, want the last one", v.ErrorType(), names)
+	}
+	if v.TokenIndex("EOI") != lexer.TKN_EOF {
+		t.Errorf("got tokens %v, want EOI first", names)
+	}
+}
+
+func TestErrorTokensReported(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  lexer.RecoveryPolicy
+		source  string
+		idents  int
+		invalid []string
+	}{
+		{name: "skip char", policy: lexer.SKIP_CHAR, source: "a # b ## c", idents: 3,
+			invalid: []string{"invalid characters '#' skipped", "invalid characters '##' skipped"}},
+		{name: "skip to space", policy: lexer.SKIP_TO_SPACE, source: "%%b c", idents: 1,
+			invalid: []string{"invalid characters '%%b' skipped"}},
+		{name: "skip to line", policy: lexer.SKIP_TO_LINE, source: "a %b c\nd", idents: 2,
+			invalid: []string{"invalid characters '%b c' skipped"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, identsGrammar, test.source)
+			p.Lexer().SetErrorTokens(true)
+			p.Lexer().SetRecoveryPolicy(test.policy)
+			root := p.Execute()
+			if root == nil {
+				t.Fatalf("parse failed: %v", p.Errors())
+			}
+			if idents := len(root.Children()); idents != test.idents {
+				t.Errorf("got %d identifiers, want %d", idents, test.idents)
+			}
+			if len(p.Errors()) != len(test.invalid) {
+				t.Fatalf("got errors %v, want %q", p.Errors(), test.invalid)
+			}
+			for i, err := range p.Errors() {
+				if err.Code() != parser.INVALID_TOKEN_ERROR || err.Message() != test.invalid[i] {
+					t.Errorf("got error %v, want %q", err, test.invalid[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenTypesCopied(t *testing.T) {
+	l := newParser(t, identsGrammar, "a").Lexer()
+	token, err := l.NextToken()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	types := token.Types()
+	want := types[0]
+	types[0] = -1
+	again, err := l.Token(0)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if !token.IsType(want) || again.Type(0) != want {
+		t.Errorf("changing the types returned changed the types %v of the token", again.Types())
+	}
+}
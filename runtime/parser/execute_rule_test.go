@@ -0,0 +1,68 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const exprGrammar = `grammar Expr;
+
+Program : Expr EOI;
+
+Expr : Expr '+' Term | Expr '-' Term | Term;
+
+Term : Term '*' Number | Number;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+func TestUntilEOI(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     string
+		untilEOI bool
+		source   string
+		want     string
+		errors   int
+	}{
+		{name: "start rule with EOI", rule: "Program", untilEOI: true, source: "1+2", want: "1+2"},
+		{name: "start rule with EOI and spaces", rule: "Program", untilEOI: true, source: " 1 + 2 \n", want: "1 + 2 \n"},
+		{name: "start rule with EOI not until EOI", rule: "Program", source: "1+2", want: "1+2"},
+		{name: "start rule with trailing tokens", rule: "Program", untilEOI: true, source: "1+2 3", errors: 1},
+		{name: "rule without EOI", rule: "Expr", untilEOI: true, source: "1 + 2*3 ", want: "1 + 2*3"},
+		{name: "rule without EOI and trailing tokens", rule: "Expr", untilEOI: true, source: "1 + 2 3", errors: 1},
+		{name: "prefix of the input", rule: "Expr", source: "1 + 2 3", want: "1 + 2"},
+		{name: "rule without EOI and trailing operator", rule: "Expr", untilEOI: true, source: "1 + 2 +", errors: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, exprGrammar, test.source)
+			p.SetUntilEOI(test.untilEOI)
+			var root *parser.ASTNode
+			if test.rule == "Program" {
+				root = p.Execute()
+			} else {
+				root = p.ExecuteRule(test.rule)
+			}
+			if len(p.Errors()) != test.errors || len(p.Lexer().Errors()) > 0 {
+				t.Fatalf("got errors %v and lexer errors %v, want %d errors", p.Errors(), p.Lexer().Errors(), test.errors)
+			}
+			if test.errors > 0 {
+				if root != nil {
+					t.Errorf("got tree %s of invalid input", treeString(p, root))
+				}
+				return
+			}
+			if root == nil {
+				t.Fatalf("parse failed")
+			}
+			if got := p.NodeText(root); got != test.want {
+				t.Errorf("got text %q, want %q", got, test.want)
+			}
+		})
+	}
+}
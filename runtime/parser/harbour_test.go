@@ -0,0 +1,136 @@
+package parser_test
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const harbourFunction = `/* function %[1]d */
+function Func%[1]d( a, b )
+   local x := %[1]d, y := { 1, 2, "a" }, i
+   // the loops below
+   if x == 1 .and. !Empty( y )
+      x += Len( y ) * 2
+   elseif x > 3
+      x--
+   else
+      QOut( "other" ) ; x := y[ 1 ]
+   endif
+   do while x < 10
+      x++
+      if x = 5 ; exit ; endif
+   enddo
+   for i := 1 to 10 step 2
+      y[ i ] := {|z| z + i }
+   next
+   do case
+   case x == 1
+      x := 2
+   otherwise
+      o:Send( 1, , 2 ):Value := .T.
+   endcase
+   return x + ::nValue
+`
+
+// harbourSource writes the count of functions in Harbour, with 25 lines each.
+func harbourSource(count int) string {
+	source := strings.Builder{}
+	for i := range count {
+		fmt.Fprintf(&source, harbourFunction, i)
+	}
+	return source.String()
+}
+
+// harbourParser builds the parser of the Harbour example grammar for the source.
+func harbourParser(t testing.TB, source string) *parser.Parser {
+	t.Helper()
+	g, err := grammar.FromFile("../../examples/HarbourCore.gy")
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	return parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+}
+
+func TestHarbourSource(t *testing.T) {
+	p := harbourParser(t, harbourSource(2))
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	declarations := root.List(p.Syntax(), "FunctionDeclaration")
+	if len(declarations) != 2 || p.NodeText(declarations[1]) != "function Func1( a, b )" {
+		t.Errorf("got declarations %v, want Func0 and Func1", declarations)
+	}
+	for node := range root.Descendants() {
+		if node.Parent() == nil || node.Parent().FirstChild() == nil {
+			t.Fatalf("node %s has no parent", p.Syntax().RuleName(node.RuleType()))
+		}
+	}
+}
+
+// BenchmarkHarbour parses Harbour sources of 2500 and 25000 lines with the tree,
+// the concrete syntax tree and the streaming modes, reporting the garbage
+// collections not forced by the benchmark, the heap in use by the tree returned
+// and the tokens, not counting the input, and the time of a collection with the
+// tree in use.
+func BenchmarkHarbour(b *testing.B) {
+	if _, err := os.Stat("../../examples/HarbourCore.gy"); err != nil {
+		b.Skip("Harbour example grammar not found")
+	}
+	modes := []struct {
+		name  string
+		setup func(p *parser.Parser)
+	}{
+		{name: "tree", setup: func(p *parser.Parser) {}},
+		{name: "cst", setup: func(p *parser.Parser) { p.SetCST(true) }},
+		{name: "stream", setup: func(p *parser.Parser) { p.SetListener(&stmtListener{stmtRule: -1}) }},
+	}
+	for _, count := range []int{100, 1000} {
+		source := harbourSource(count)
+		for _, mode := range modes {
+			b.Run(fmt.Sprintf("%s-%d", mode.name, count*25), func(b *testing.B) {
+				var used uint64
+				var marking time.Duration
+				var stats runtime.MemStats
+				runtime.ReadMemStats(&stats)
+				collections := stats.NumGC - stats.NumForcedGC
+				b.ReportAllocs()
+				for range b.N {
+					b.StopTimer()
+					p := harbourParser(b, source)
+					mode.setup(p)
+					base := liveHeap()
+					b.StartTimer()
+					root := p.Execute()
+					if root == nil {
+						b.Fatalf("parse failed: %v", p.Errors())
+					}
+					b.StopTimer()
+					start := time.Now()
+					runtime.GC()
+					marking += time.Since(start)
+					used = max(used, heapGrowth(base))
+					runtime.KeepAlive(root)
+					runtime.KeepAlive(p)
+					b.StartTimer()
+				}
+				runtime.ReadMemStats(&stats)
+				b.ReportMetric(float64(stats.NumGC-stats.NumForcedGC-collections)/float64(b.N), "gc/op")
+				b.ReportMetric(float64(used), "heap-B")
+				b.ReportMetric(float64(marking.Nanoseconds())/float64(b.N), "gc-ns")
+			})
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package parser_test
+
+import "testing"
+
+const indirectGrammar = `grammar Indirect;
+
+Program : A EOI;
+
+A : B 'a' | 'x';
+
+B : A 'b' | 'y';
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// TestLeftRecursion checks that the seeds of the left recursive rules grow to
+// the longest match, nesting the shorter ones as their first children, so the
+// operators are left associative.
+func TestLeftRecursion(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar string
+		source  string
+		want    string
+	}{
+		{name: "seed only", grammar: exprGrammar, source: "1", want: "Expr(1 Term(1))"},
+		{
+			name:    "direct",
+			grammar: exprGrammar,
+			source:  "1 + 2 + 3",
+			want:    "Expr(1 + 2 + 3 Expr(1 + 2 Expr(1 Term(1))Term(2))Term(3))",
+		},
+		{
+			name:    "direct in two rules",
+			grammar: exprGrammar,
+			source:  "1 - 2 + 3 * 4 * 5",
+			want:    "Expr(1 - 2 + 3 * 4 * 5 Expr(1 - 2 Expr(1 Term(1))Term(2))Term(3 * 4 * 5 Term(3 * 4 Term(3))))",
+		},
+		{name: "indirect seed only", grammar: indirectGrammar, source: "x", want: "A(x)"},
+		{name: "indirect", grammar: indirectGrammar, source: "xbaba", want: "A(xbaba B(xbab A(xba B(xb A(x)))))"},
+		{name: "indirect from the other rule", grammar: indirectGrammar, source: "yaba", want: "A(yaba B(yab A(ya B(y))))"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, test.grammar, test.source)
+			root := p.Execute()
+			if root == nil {
+				t.Fatalf("parse failed: %v", p.Errors())
+			}
+			if got := treeString(p, root); got != test.want {
+				t.Errorf("got tree %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLeftRecursionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar string
+		source  string
+	}{
+		{name: "direct trailing operator", grammar: exprGrammar, source: "1 + 2 +"},
+		{name: "indirect incomplete cycle", grammar: indirectGrammar, source: "xbab"},
+		{name: "indirect without seed", grammar: indirectGrammar, source: "ba"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, test.grammar, test.source)
+			if root := p.Execute(); root != nil || len(p.Errors()) == 0 {
+				t.Errorf("got tree %v and errors %v, want an error", root, p.Errors())
+			}
+		})
+	}
+}
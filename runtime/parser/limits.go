@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+)
+
+// Limits bounds the resources used by an execution of the parser. A limit
+// less than or equal to zero is not checked.
+type Limits struct {
+	// MaxDepth is the maximum number of nested rules being parsed.
+	MaxDepth int
+	// MaxTokens is the maximum number of tokens read from the lexer. The tokens
+	// read again after backtracking are counted again.
+	MaxTokens int
+	// MaxNodes is the maximum number of AST nodes created.
+	MaxNodes int
+	// MaxBacktracks is the maximum number of rules that fail and make the parser go back.
+	MaxBacktracks int
+}
+
+// LimitError aborts the execution of the parser when one of its limits is exceeded.
+type LimitError struct {
+	row     int
+	col     int
+	code    int
+	limit   int
+	message string
+}
+
+// CanceledError aborts the execution of the parser when its context is done.
+type CanceledError struct {
+	row   int
+	col   int
+	cause error
+}
+
+// contextCheckInterval is the number of rules parsed, or of tokens read, between
+// two checks of the context.
+const contextCheckInterval = 1024
+
+func (e *LimitError) Row() int {
+	return e.row
+}
+
+func (e *LimitError) Col() int {
+	return e.col
+}
+
+func (e *LimitError) Code() int {
+	return e.code
+}
+
+// Limit returns the value of the limit exceeded.
+func (e *LimitError) Limit() int {
+	return e.limit
+}
+
+func (e *LimitError) Message() string {
+	return e.message
+}
+
+func (e *LimitError) String() string {
+	return fmt.Sprintf("Error %d: %s at row %d, col %d", e.code, e.message, e.row, e.col)
+}
+
+func (e *LimitError) Error() string {
+	return e.String()
+}
+
+func (e *CanceledError) Row() int {
+	return e.row
+}
+
+func (e *CanceledError) Col() int {
+	return e.col
+}
+
+func (e *CanceledError) Code() int {
+	return CANCELED_ERROR
+}
+
+func (e *CanceledError) Message() string {
+	return "parsing canceled: " + e.cause.Error()
+}
+
+func (e *CanceledError) String() string {
+	return fmt.Sprintf("Error %d: %s at row %d, col %d", CANCELED_ERROR, e.Message(), e.row, e.col)
+}
+
+func (e *CanceledError) Error() string {
+	return e.String()
+}
+
+// Unwrap returns the error of the context, context.Canceled or context.DeadlineExceeded.
+func (e *CanceledError) Unwrap() error {
+	return e.cause
+}
+
+func (p *Parser) SetLimits(limits Limits) {
+	p.limits = limits
+}
+
+func (p *Parser) Limits() Limits {
+	return p.limits
+}
+
+// ExecuteContext parses the input like Execute, but stops with a CanceledError
+// when the context is done, including before the parsing starts.
+func (p *Parser) ExecuteContext(ctx context.Context) *ASTNode {
+	p.ctx = ctx
+	defer func() { p.ctx = nil }()
+	return p.Execute()
+}
+
+// enterRule checks the limits before a rule is parsed. It returns false when
+// the execution is aborted.
+func (p *Parser) enterRule() bool {
+	if p.aborted != nil {
+		return false
+	}
+	if p.limits.MaxDepth > 0 && p.depth >= p.limits.MaxDepth {
+		p.limitExceeded(DEPTH_LIMIT_ERROR, p.limits.MaxDepth, "maximum recursion depth of %d rules exceeded")
+		return false
+	}
+	p.depth++
+	p.calls++
+	if p.calls%contextCheckInterval == 0 {
+		return p.checkContext()
+	}
+	return true
+}
+
+// checkContext aborts the execution when the context is done. It returns false
+// when the execution is aborted.
+func (p *Parser) checkContext() bool {
+	if p.ctx == nil {
+		return true
+	}
+	if err := p.ctx.Err(); err != nil {
+		row, col := p.abortPosition()
+		p.aborted = &CanceledError{row: row, col: col, cause: err}
+		return false
+	}
+	return true
+}
+
+func (p *Parser) exitRule(match bool) {
+	p.depth--
+	if !match && p.aborted == nil {
+		p.backtracks++
+		if p.limits.MaxBacktracks > 0 && p.backtracks > p.limits.MaxBacktracks {
+			p.limitExceeded(BACKTRACKS_LIMIT_ERROR, p.limits.MaxBacktracks, "maximum of %d backtracks exceeded")
+		}
+	}
+}
+
+// countToken counts a token read from the lexer and checks the tokens limit and
+// the context. It returns false when the execution is aborted.
+func (p *Parser) countToken() bool {
+	p.tokensRead++
+	if p.limits.MaxTokens > 0 && p.tokensRead > p.limits.MaxTokens {
+		p.limitExceeded(TOKENS_LIMIT_ERROR, p.limits.MaxTokens, "maximum of %d tokens exceeded")
+		return false
+	}
+	if p.tokensRead%contextCheckInterval == 0 {
+		return p.checkContext()
+	}
+	return true
+}
+
+func (p *Parser) countNode() {
+	p.nodes++
+	if p.limits.MaxNodes > 0 && p.nodes > p.limits.MaxNodes && p.aborted == nil {
+		p.limitExceeded(NODES_LIMIT_ERROR, p.limits.MaxNodes, "maximum of %d AST nodes exceeded")
+	}
+}
+
+func (p *Parser) limitExceeded(code int, limit int, message string) {
+	row, col := p.abortPosition()
+	p.aborted = &LimitError{
+		row:     row,
+		col:     col,
+		code:    code,
+		limit:   limit,
+		message: fmt.Sprintf(message, limit),
+	}
+}
+
+func (p *Parser) abortPosition() (int, int) {
+	tkn, err := p.lexer.Token(p.lexer.Index())
+	if err != nil {
+		return p.lexer.Row(), p.lexer.Col()
+	}
+	return tkn.Row(), tkn.Col()
+}
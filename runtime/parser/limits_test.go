@@ -0,0 +1,147 @@
+package parser_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const limitsGrammar = `grammar Limits;
+
+Program : Stmt* EOI;
+
+Stmt : Identifier '=' Number ';' | Identifier '=' Identifier ';';
+
+Number : [0-9]+;
+
+Identifier : ([a-z] | [A-Z]) ([a-z] | [A-Z] | [0-9])*;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+func TestExecuteContextCanceledBeforeParsing(t *testing.T) {
+	p := newParser(t, limitsGrammar, "a = 1;")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if root := p.ExecuteContext(ctx); root != nil {
+		t.Fatalf("got a tree from a canceled context")
+	}
+	errs := p.Errors()
+	if len(errs) != 1 || errs[0].Code() != parser.CANCELED_ERROR {
+		t.Fatalf("got errors %v, want one canceled error", errs)
+	}
+	canceled, ok := errs[0].(*parser.CanceledError)
+	if !ok || !errors.Is(canceled, context.Canceled) {
+		t.Errorf("got %v, want an error wrapping context.Canceled", errs[0])
+	}
+}
+
+func TestMaxTokensCountsTokensRead(t *testing.T) {
+	// "a = b;" is read twice: the first alternative fails at b and the second
+	// one reads the statement again.
+	tests := []struct {
+		maxTokens int
+		aborted   bool
+	}{
+		{maxTokens: 9, aborted: true},
+		{maxTokens: 15, aborted: false},
+	}
+	for _, test := range tests {
+		p := newParser(t, limitsGrammar, "a = b;")
+		p.SetLimits(parser.Limits{MaxTokens: test.maxTokens})
+		root := p.Execute()
+		if aborted := root == nil; aborted != test.aborted {
+			t.Fatalf("max tokens %d: got aborted %v, want %v: %v", test.maxTokens, aborted, test.aborted, p.Errors())
+		}
+		if test.aborted && p.Errors()[0].Code() != parser.TOKENS_LIMIT_ERROR {
+			t.Errorf("max tokens %d: got errors %v, want the tokens limit error", test.maxTokens, p.Errors())
+		}
+	}
+}
+
+const nestedGrammar = `grammar Nested;
+
+Program : Expr EOI;
+
+Expr : '(' Expr ')' | Identifier;
+
+Identifier : [a-z]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// nested returns the identifier inside the number of parentheses.
+func nested(depth int) string {
+	return strings.Repeat("(", depth) + "a" + strings.Repeat(")", depth)
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar string
+		source  string
+		limits  parser.Limits
+		code    int
+		col     int
+	}{
+		// each level of parentheses nests Expr and its sequence
+		{name: "depth reached", grammar: nestedGrammar, source: nested(3), limits: parser.Limits{MaxDepth: 9}},
+		{name: "depth exceeded", grammar: nestedGrammar, source: nested(3), limits: parser.Limits{MaxDepth: 8}, code: parser.DEPTH_LIMIT_ERROR, col: 4},
+		{name: "depth of deep nesting", grammar: nestedGrammar, source: nested(500), limits: parser.Limits{MaxDepth: 1000}, code: parser.DEPTH_LIMIT_ERROR, col: 500},
+		// the statements and the end of input are the nodes
+		{name: "nodes reached", grammar: limitsGrammar, source: "a = 1; b = c;", limits: parser.Limits{MaxNodes: 3}},
+		{name: "nodes exceeded", grammar: limitsGrammar, source: "a = 1; b = c;", limits: parser.Limits{MaxNodes: 2}, code: parser.NODES_LIMIT_ERROR, col: 14},
+		// three rules fail: the first alternative of "b = c;", and then two
+		// rules of the statement tried at the end of input
+		{name: "backtracks reached", grammar: limitsGrammar, source: "a = 1; b = c;", limits: parser.Limits{MaxBacktracks: 3}},
+		{name: "backtracks exceeded", grammar: limitsGrammar, source: "a = 1; b = c;", limits: parser.Limits{MaxBacktracks: 2}, code: parser.BACKTRACKS_LIMIT_ERROR, col: 14},
+		{name: "backtracks exceeded early", grammar: limitsGrammar, source: "a = 1; b = c;", limits: parser.Limits{MaxBacktracks: 1}, code: parser.BACKTRACKS_LIMIT_ERROR, col: 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, test.grammar, test.source)
+			p.SetLimits(test.limits)
+			root := p.Execute()
+			if test.code == 0 {
+				if root == nil {
+					t.Fatalf("parse failed: %v", p.Errors())
+				}
+				return
+			}
+			if root != nil {
+				t.Fatalf("got a tree, want the limit error %d", test.code)
+			}
+			errs := p.Errors()
+			if len(errs) != 1 || errs[0].Code() != test.code {
+				t.Fatalf("got errors %v, want only the limit error %d", errs, test.code)
+			}
+			limitErr, ok := errs[0].(*parser.LimitError)
+			if !ok {
+				t.Fatalf("got %T, want a limit error", errs[0])
+			}
+			limit := max(test.limits.MaxDepth, test.limits.MaxNodes, test.limits.MaxBacktracks)
+			if limitErr.Limit() != limit || !strings.Contains(limitErr.Message(), strconv.Itoa(limit)) {
+				t.Errorf("got limit %d in %q, want %d", limitErr.Limit(), limitErr.Message(), limit)
+			}
+			if limitErr.Row() != 1 || limitErr.Col() != test.col {
+				t.Errorf("got the error at %d, %d, want 1, %d", limitErr.Row(), limitErr.Col(), test.col)
+			}
+		})
+	}
+}
+
+func TestLimitsResetOnExecute(t *testing.T) {
+	p := newParser(t, limitsGrammar, "a = 1; b = c;")
+	p.SetLimits(parser.Limits{MaxNodes: 3, MaxBacktracks: 3})
+	for i := range 2 {
+		if root := p.Execute(); root == nil {
+			t.Fatalf("execution %d: parse failed: %v", i+1, p.Errors())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package parser_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const lookaheadGrammar = `grammar Lookahead;
+
+Program : Stmt* EOI;
+
+@Memoize
+Stmt : Assign | Call | Block;
+
+@Memoize
+Assign : Ident '=' Value ';';
+
+@Memoize
+Call : 'call' Ident Args ';';
+
+@Memoize
+Block : '{' Stmt* '}';
+
+Args : ('(' Value ')')?;
+
+Value : Args Number | Sign Number | Ident;
+
+Sign : ('-' | '+')?;
+
+Number : [0-9]+;
+
+Ident : [a-z]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// parseResult parses the source and returns its tree and errors.
+func parseResult(p *parser.Parser) string {
+	root := p.Execute()
+	if root == nil {
+		return fmt.Sprint(p.Errors())
+	}
+	return treeString(p, root) + fmt.Sprint(p.Errors())
+}
+
+// TestLookahead checks that the alternatives skipped by their first tokens give
+// the same trees and errors as trying them, also when they start with nullable
+// rules, and that they are not tried.
+func TestLookahead(t *testing.T) {
+	tests := []struct {
+		source string
+		misses int
+		plain  int
+	}{
+		{source: "a = 1;", misses: 3, plain: 6},
+		{source: "call f; { b = -2; call g (3); } c = d;", misses: 14, plain: 22},
+		{source: "{ { a = (x) 1; } call h; } b = +4;", misses: 14, plain: 27},
+		{source: "a = ;", misses: 2, plain: 4},
+		{source: "call 1;", misses: 3, plain: 4},
+		{source: "{ a = 1; call", misses: 7, plain: 10},
+		{source: "a = (1 2;", misses: 2, plain: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			p := newParser(t, lookaheadGrammar, test.source)
+			got := parseResult(p)
+			plain := newParser(t, lookaheadGrammar, test.source)
+			for ruleId := range plain.Syntax().RulesCount() {
+				plain.Syntax().SetLookahead(ruleId, nil)
+			}
+			if want := parseResult(plain); got != want {
+				t.Errorf("got %s with lookahead, want %s", got, want)
+			}
+			// each memoized rule tried at a new position is a miss
+			if misses := p.MemoStats().Misses; misses != test.misses {
+				t.Errorf("got %d rules tried with lookahead, want %d", misses, test.misses)
+			}
+			if misses := plain.MemoStats().Misses; misses != test.plain {
+				t.Errorf("got %d rules tried without lookahead, want %d", misses, test.plain)
+			}
+		})
+	}
+}
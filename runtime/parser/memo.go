@@ -0,0 +1,193 @@
+package parser
+
+// DEFAULT_MEMO_LIMIT is the default number of results kept by the memo table.
+const DEFAULT_MEMO_LIMIT = 1 << 16
+
+// MemoStats are the counters of the memo table of the last execution of the parser.
+type MemoStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+}
+
+type memoKey struct {
+	rule  int
+	index int
+}
+
+// memoEntry is the result of a rule parsed at a token index. The expected token
+// types at the farthest failure of the rule are kept to report the same syntax
+// error when the result is reused. A result that used the seed of a left
+// recursive rule being grown is only valid in the same growth iteration, that
+// is not zero.
+type memoEntry struct {
+	growth    int
+	match     bool
+	ignore    bool
+	predicate bool
+	end       int
+	first     int32
+	last      int32
+	farthest  int
+	expected  []int
+}
+
+// memoTable keeps the results of the rules marked with @Memoize. When the limit
+// is reached, the oldest results are evicted.
+type memoTable struct {
+	entries map[memoKey]*memoEntry
+	order   []memoKey
+	oldest  int
+	limit   int
+	stats   MemoStats
+}
+
+func newMemoTable(limit int) *memoTable {
+	return &memoTable{
+		entries: make(map[memoKey]*memoEntry),
+		order:   make([]memoKey, 0),
+		limit:   limit,
+	}
+}
+
+// get returns the result valid in the growth iteration, counting the results
+// of other iterations as misses.
+func (m *memoTable) get(key memoKey, growth int) *memoEntry {
+	entry, found := m.entries[key]
+	if !found || (entry.growth != 0 && entry.growth != growth) {
+		m.stats.Misses++
+		return nil
+	}
+	m.stats.Hits++
+	return entry
+}
+
+func (m *memoTable) put(key memoKey, entry *memoEntry) {
+	if _, found := m.entries[key]; found {
+		m.entries[key] = entry
+		return
+	}
+	if len(m.entries) >= m.limit {
+		m.evict()
+	}
+	m.entries[key] = entry
+	if len(m.order) < m.limit {
+		m.order = append(m.order, key)
+	} else {
+		m.order[m.oldest] = key
+		m.oldest = (m.oldest + 1) % m.limit
+	}
+}
+
+func (m *memoTable) evict() {
+	delete(m.entries, m.order[m.oldest])
+	m.stats.Evictions++
+}
+
+func (m *memoTable) reset() {
+	m.clearEntries()
+	m.stats = MemoStats{}
+}
+
+// clearEntries drops the results, keeping the counters.
+func (m *memoTable) clearEntries() {
+	clear(m.entries)
+	m.order = m.order[:0]
+	m.oldest = 0
+}
+
+// SetMemoLimit sets the maximum number of results kept by the memo table of the
+// rules marked with @Memoize. A limit less than or equal to zero disables the memoization.
+func (p *Parser) SetMemoLimit(limit int) {
+	if limit <= 0 {
+		p.memo = nil
+	} else {
+		p.memo = newMemoTable(limit)
+	}
+}
+
+func (p *Parser) MemoLimit() int {
+	if p.memo == nil {
+		return 0
+	}
+	return p.memo.limit
+}
+
+// MemoStats returns the hits, misses and evictions of the memo table in the last execution.
+func (p *Parser) MemoStats() MemoStats {
+	if p.memo == nil {
+		return MemoStats{}
+	}
+	return p.memo.stats
+}
+
+func (p *Parser) isMemoized(ruleId int) bool {
+	return p.memo != nil && len(p.recoveries) == 0 && p.syntax.HasOption(ruleId, MEMOIZE)
+}
+
+// parseMemoizedRule parses the rule at the current position once and reuses the
+// result every time the rule is tried again at the same position.
+func (p *Parser) parseMemoizedRule(ruleId int) bool {
+	lastNode := p.currentNode
+	index := p.lexer.Index()
+	key := memoKey{rule: ruleId, index: index}
+	entry := p.memo.get(key, p.growth)
+	if entry != nil && entry.ignore == p.ignore && (!entry.predicate || p.predicates > 0) {
+		for _, tokenType := range entry.expected {
+			p.expect(entry.farthest, tokenType)
+		}
+		if !entry.match {
+			return false
+		}
+		p.linkClones(lastNode, entry.first, entry.last)
+		p.lexer.SetIndex(entry.end)
+		return true
+	}
+	farthest, expected := p.farthest, p.expected
+	p.farthest, p.expected = -1, make([]int, 0)
+	seedUses := p.seedUses
+	match := p.evalRule(ruleId, -1)
+	entry = &memoEntry{
+		match:     match,
+		ignore:    p.ignore,
+		predicate: p.predicates > 0,
+		end:       p.lexer.Index(),
+		farthest:  p.farthest,
+		expected:  p.expected,
+		first:     noNode,
+		last:      noNode,
+	}
+	if p.seedUses != seedUses {
+		entry.growth = p.growth
+	}
+	if match {
+		entry.first = p.arena.sibling(lastNode)
+		if entry.first != noNode {
+			entry.last = p.currentNode
+		}
+	}
+	p.memo.put(key, entry)
+	p.farthest, p.expected = farthest, expected
+	for _, tokenType := range entry.expected {
+		p.expect(entry.farthest, tokenType)
+	}
+	return match
+}
+
+// linkClones appends copies of the chain of nodes from first to last after lastNode,
+// so the memoized nodes are never linked to other siblings.
+func (p *Parser) linkClones(lastNode int32, first int32, last int32) {
+	if first == noNode {
+		return
+	}
+	for node := first; ; node = p.arena.sibling(node) {
+		clone := p.arena.clone(node)
+		p.countNode()
+		p.arena.setSibling(lastNode, clone)
+		lastNode = clone
+		if node == last {
+			break
+		}
+	}
+	p.currentNode = lastNode
+}
@@ -0,0 +1,155 @@
+package parser_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const memoGrammar = `grammar Memo;
+
+Program : Stmt* EOI;
+
+Stmt : List ';' | List '.' | List '!';
+
+@Memoize
+List : '[' Item* ']';
+
+Item : Number | List;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+func TestMemoStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		stats  parser.MemoStats
+	}{
+		{name: "first alternative", source: "[1 2];", stats: parser.MemoStats{Hits: 0, Misses: 1}},
+		{name: "last alternative", source: "[1 2]!", stats: parser.MemoStats{Hits: 2, Misses: 1}},
+		{name: "nested lists", source: "[1 [2] [3]].", stats: parser.MemoStats{Hits: 1, Misses: 3}},
+		{name: "many statements", source: "[1]. [2]!", stats: parser.MemoStats{Hits: 3, Misses: 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, memoGrammar, test.source)
+			if p.Execute() == nil {
+				t.Fatalf("parse failed: %v", p.Errors())
+			}
+			if stats := p.MemoStats(); stats != test.stats {
+				t.Errorf("got stats %+v, want %+v", stats, test.stats)
+			}
+		})
+	}
+}
+
+func TestMemoEviction(t *testing.T) {
+	p := newParser(t, memoGrammar, "[1]! [2]! [3]!")
+	p.SetMemoLimit(1)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	stats := p.MemoStats()
+	if stats.Evictions != 2 {
+		t.Errorf("got %d evictions, want 2", stats.Evictions)
+	}
+	if stats.Hits != 6 || stats.Misses != 3 {
+		t.Errorf("got stats %+v, want 6 hits and 3 misses", stats)
+	}
+	want := treeString(parseWithoutMemo(t, memoGrammar, "[1]! [2]! [3]!"))
+	if got := treeString(p, root); got != want {
+		t.Errorf("got tree %s, want %s", got, want)
+	}
+}
+
+// TestMemoParents checks that the nodes of the results reused from the memo
+// table have the parents of the tree returned.
+func TestMemoParents(t *testing.T) {
+	p := newParser(t, memoGrammar, "[1 [2]]! [3]!")
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	for node := range root.Descendants() {
+		if !slices.Contains(node.Parent().Children(), node) {
+			t.Errorf("node %s is not a child of its parent", p.NodeText(node))
+		}
+	}
+}
+
+func TestMemoDisabled(t *testing.T) {
+	p := newParser(t, memoGrammar, "[1 2]!")
+	p.SetMemoLimit(0)
+	if p.Execute() == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	if stats := p.MemoStats(); stats != (parser.MemoStats{}) {
+		t.Errorf("got stats %+v without memo table", stats)
+	}
+}
+
+// TestMemoInLeftRecursion checks that the results of memoized rules parsed while
+// a left recursive rule grows give the same tree as without memoization.
+func TestMemoInLeftRecursion(t *testing.T) {
+	grammars := []string{`grammar MemoLr;
+
+Program : Expr EOI;
+
+Expr : Expr '+' List | Expr '-' List | List;
+
+@Memoize
+List : '[' Expr* ']' | Number;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`, `grammar MemoSum;
+
+Program : Sum EOI;
+
+@Memoize
+Sum : Expr;
+
+Expr : Sum '+' Number | Number;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`}
+	sources := [][]string{
+		{"1", "1 + 2 - 3", "[1 + 2] - [3 [4 - 5]] + 6", "[[1] + [2 + [3]]] - 4"},
+		{"1", "1 + 2", "1 + 2 + 3 + 4"},
+	}
+	for i, grammarSource := range grammars {
+		for _, source := range sources[i] {
+			p := newParser(t, grammarSource, source)
+			root := p.Execute()
+			if root == nil {
+				t.Fatalf("%s: parse failed: %v", source, p.Errors())
+			}
+			want := treeString(parseWithoutMemo(t, grammarSource, source))
+			if got := treeString(p, root); got != want {
+				t.Errorf("%s: got tree %s, want %s", source, got, want)
+			}
+		}
+	}
+}
+
+func parseWithoutMemo(t *testing.T, grammarSource string, source string) (*parser.Parser, *parser.ASTNode) {
+	t.Helper()
+	p := newParser(t, grammarSource, source)
+	p.SetMemoLimit(0)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("%s: parse without memo failed: %v", source, p.Errors())
+	}
+	return p, root
+}
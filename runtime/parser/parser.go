@@ -1,32 +1,87 @@
 package parser
 
 import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
 	"github.com/fabiouggeri/page/runtime/error"
 	"github.com/fabiouggeri/page/runtime/lexer"
 )
 
 type memorizedRule struct {
-	node  *ASTNode
+	node  int32
 	start int
 	end   int
 }
 
+type leftRecursion struct {
+	rule  int
+	index int
+	end   int
+	match bool
+	first int32
+	last  int32
+}
+
 type Parser struct {
 	lexer       *lexer.Lexer
 	syntax      *Syntax
-	currentNode *ASTNode
+	currentNode int32
 	errors      []error.Error
 	memorized   []*memorizedRule
+	memo        *memoTable
+	growing     []*leftRecursion
+	expected    []int
+	farthest    int
+	lexFailedAt int
+	lexFailure  error.Error
+	errorToken  int
+	reached     int
+	growthEnd   int
+	growth      int
+	growths     int
+	seedUses    int
+	predicates  int
+	recovery    bool
+	untilEOI    bool
+	cst         bool
+	recoveries  []int
+	sequences   []sequence
 	ignore      bool
+	ctx         context.Context
+	limits      Limits
+	aborted     error.Error
+	depth       int
+	calls       int
+	nodes       int
+	backtracks  int
+	tokensRead  int
+	listener    Listener
+	speculative int
+	streamHead  int32
+	streamIndex int
+	streamDepth int
+	streamed    *ASTNode
+	arena       *nodeArena
+	builders    []Builder
+	comments    map[*ASTNode]*nodeComments
 }
 
 func New(l *lexer.Lexer, s *Syntax) *Parser {
 	return &Parser{
-		lexer:     l,
-		syntax:    s,
-		errors:    make([]error.Error, 0),
-		memorized: make([]*memorizedRule, len(s.rulesNames)),
-		ignore:    false,
+		lexer:       l,
+		syntax:      s,
+		errors:      make([]error.Error, 0),
+		memorized:   make([]*memorizedRule, len(s.rulesNames)),
+		memo:        newMemoTable(DEFAULT_MEMO_LIMIT),
+		expected:    make([]int, 0),
+		farthest:    -1,
+		lexFailedAt: -1,
+		errorToken:  -1,
+		reached:     -1,
+		ignore:      false,
 	}
 }
 
@@ -43,48 +98,189 @@ func (p *Parser) Execute() *ASTNode {
 	if startRule < 0 || startRule >= p.syntax.RulesCount() {
 		panic("undefined start rule")
 	}
-	p.currentNode = NewASTNode(-1, 0, 0)
-	if p.parseRule(startRule) {
-		return p.currentNode
+	return p.ExecuteRuleId(startRule)
+}
+
+// ExecuteRule parses the input starting from the rule with the name, instead of the start rule.
+func (p *Parser) ExecuteRule(name string) *ASTNode {
+	ruleId := p.syntax.RuleId(name)
+	if ruleId < 0 {
+		panic("undefined rule " + name)
+	}
+	return p.ExecuteRuleId(ruleId)
+}
+
+// ExecuteRuleId parses the input starting from the rule with the id, instead of the start rule.
+func (p *Parser) ExecuteRuleId(startRule int) *ASTNode {
+	if startRule < 0 || startRule >= p.syntax.RulesCount() {
+		panic("undefined rule " + strconv.Itoa(startRule))
+	}
+	p.recoveries = p.recoveries[:0]
+	p.aborted = nil
+	p.calls = 0
+	p.tokensRead = 0
+	p.backtracks = 0
+	p.errorToken = -1
+	if p.memo != nil {
+		p.memo.reset()
+	}
+	node := p.parse(startRule)
+	for node == nil && p.canRecover() {
+		p.recoveries = append(p.recoveries, p.farthest)
+		node = p.parse(startRule)
+	}
+	return node
+}
+
+func (p *Parser) parse(startRule int) *ASTNode {
+	arena := &nodeArena{parsing: true}
+	defer func() { arena.parsing = false }()
+	p.arena = arena
+	p.currentNode = p.arena.newNode(-1, 0, 0)
+	p.depth = 0
+	p.nodes = 0
+	p.farthest = -1
+	p.lexFailedAt = -1
+	p.reached = -1
+	p.growthEnd = -1
+	p.expected = p.expected[:0]
+	p.growing = p.growing[:0]
+	clear(p.memorized)
+	clear(p.comments)
+	p.speculative = 0
+	p.streamHead = p.currentNode
+	p.streamIndex = 0
+	p.streamDepth = 0
+	p.streamed = nil
+	p.lexer.SetIndex(0)
+	match := p.checkContext() && p.parseRule(startRule)
+	if p.aborted != nil {
+		p.errors = append(p.errors, p.aborted)
+		return nil
+	}
+	if match && (!p.untilEOI || p.atEOI()) {
+		if p.listener != nil {
+			p.flush()
+			if p.streamed != nil && p.streamed.RuleType() == startRule {
+				return p.streamed
+			}
+			return p.arena.view(p.currentNode)
+		}
+		root := p.arena.compact(p.currentNode)
+		p.arena = root.arena
+		if p.cst {
+			p.attachTrivia(root)
+		}
+		return root
+	}
+	if len(p.recoveries) == 0 || p.farthest > p.recoveries[len(p.recoveries)-1] {
+		p.syntaxError()
 	}
 	return nil
 }
 
+// SetUntilEOI sets whether the end of input must follow the rule executed. When
+// it is not set, the rule may match only a prefix of the input.
+func (p *Parser) SetUntilEOI(untilEOI bool) {
+	p.untilEOI = untilEOI
+}
+
+func (p *Parser) UntilEOI() bool {
+	return p.untilEOI
+}
+
+// atEOI reports whether only ignored tokens are left in the input, or the end
+// of input was matched already, expecting the end of input otherwise.
+func (p *Parser) atEOI() bool {
+	if p.pastEOI() {
+		return true
+	}
+	tkn, index := p.peekToken()
+	if tkn == nil || tkn.IsType(lexer.TKN_EOF) {
+		return tkn != nil
+	}
+	p.reach(index)
+	p.expect(index, lexer.TKN_EOF)
+	return false
+}
+
 func (p *Parser) Errors() []error.Error {
 	return p.errors
 }
 
 func (p *Parser) parseRule(ruleId int) bool {
-	previousIgnore := p.ignore
-	if p.syntax.HasOption(ruleId, IGNORE) {
-		p.ignore = true
+	if !p.enterRule() {
+		return false
 	}
+	var match bool
+	if p.syntax.HasOption(ruleId, LEFT_RECURSIVE) {
+		p.speculative++
+		match = p.parseLeftRecursiveRule(ruleId)
+		p.speculative--
+	} else if p.isMemoized(ruleId) {
+		p.speculative++
+		match = p.parseMemoizedRule(ruleId)
+		p.speculative--
+	} else if p.streaming() {
+		match = p.parseStreamedRule(ruleId)
+	} else {
+		match = p.evalRule(ruleId, -1)
+	}
+	p.exitRule(match)
+	return match
+}
+
+// evalRule parses the rule at the current position. When minEnd is not negative,
+// the alternatives of an ordered choice must end after the token index minEnd.
+func (p *Parser) evalRule(ruleId int, minEnd int) bool {
 	lastNode := p.currentNode
 	index := p.lexer.Index()
 	match := false
-	// tkn, _ := p.lexer.Token(index)
-	// fmt.Printf("Rule (%d, %d): %s\n", tkn.Row(), tkn.Col(), p.syntax.rulesNames[ruleId])
-	//row, col := p.lexer.Row(), p.lexer.Col()
 	mem := p.memorized[ruleId]
 	if mem != nil && mem.start == index {
 		if mem.start <= mem.end {
+			if mem.node != lastNode {
+				node := p.arena.clone(mem.node)
+				p.countNode()
+				p.linkNodes(lastNode, node, node)
+			}
 			p.lexer.SetIndex(mem.end)
 			return true
-		} else {
+		} else if len(p.recoveries) == 0 {
 			return false
 		}
 	}
+	previousIgnore := p.ignore
+	if p.syntax.HasOption(ruleId, IGNORE) {
+		p.ignore = true
+	}
 	terminal := false
 	rules := p.syntax.Subrules(ruleId)
 	switch ParserRuleType(rules[0]) {
 	case AND_RULE:
-		match = p.parseAndRule(rules)
+		if len(p.recoveries) > 0 && p.syntax.HasFollow(ruleId) {
+			match = p.parseRecoverableAndRule(ruleId, rules)
+		} else {
+			match = p.parseAndRule(rules)
+		}
 	case OR_RULE:
-		match = p.parseOrRule(rules)
+		if minEnd >= 0 {
+			match = p.parseGrowingOrRule(rules, minEnd)
+		} else {
+			match = p.parseOrRule(rules)
+		}
 	case ONE_OR_MORE_RULE:
-		match = p.parseOneOrMoreRule(rules)
+		if len(p.recoveries) > 0 {
+			match = p.parseRecoverableOneOrMoreRule(ruleId, rules)
+		} else {
+			match = p.parseOneOrMoreRule(rules)
+		}
 	case ZERO_OR_MORE_RULE:
-		match = p.parseZeroOrMoreRule(rules)
+		if len(p.recoveries) > 0 {
+			match = p.parseRecoverableZeroOrMoreRule(ruleId, rules)
+		} else {
+			match = p.parseZeroOrMoreRule(rules)
+		}
 	case OPTIONAL_RULE:
 		match = p.parseOptionalRule(rules)
 	case TEST_NOT_RULE:
@@ -99,19 +295,116 @@ func (p *Parser) parseRule(ruleId int) bool {
 	default:
 		panic("undefined rule type")
 	}
-	if !terminal {
-		if match && !p.ignore && !p.syntax.IsSubRule(ruleId) && !p.syntax.HasOption(ruleId, SKIP_NODE) {
-			p.createNode(ruleId, index, lastNode)
-		} else if mem != nil {
-			mem.start = index
-			mem.end = -1
-			mem.node = nil
+	if !match {
+		p.discardNodes(lastNode)
+	}
+	if terminal {
+		if match && p.cst && !p.ignore {
+			p.createTokenNode(ruleId, lastNode)
 		}
+	} else if match && !p.ignore && !p.syntax.IsSubRule(ruleId) && !p.syntax.HasOption(ruleId, SKIP_NODE) {
+		p.createNode(ruleId, index, lastNode)
+	} else if mem != nil {
+		mem.start = index
+		mem.end = -1
+		mem.node = noNode
 	}
 	p.ignore = previousIgnore
 	return match
 }
 
+// parseLeftRecursiveRule grows the match of a left recursive rule: the rule is
+// parsed again and again at the same position, each time reusing the previous
+// match as the result of the recursive call, until the match stops growing.
+func (p *Parser) parseLeftRecursiveRule(ruleId int) bool {
+	lastNode := p.currentNode
+	index := p.lexer.Index()
+	for i := len(p.growing) - 1; i >= 0; i-- {
+		seed := p.growing[i]
+		if seed.index != index {
+			continue
+		}
+		if seed.rule == ruleId {
+			p.seedUses++
+			if seed.match {
+				p.linkNodes(lastNode, seed.first, seed.last)
+				p.lexer.SetIndex(seed.end)
+			}
+			return seed.match
+		}
+		if p.syntax.IsInvolved(seed.rule, ruleId) {
+			return p.evalRule(ruleId, -1)
+		}
+	}
+	seed := &leftRecursion{rule: ruleId, index: index, end: -1, first: noNode, last: noNode}
+	p.growing = append(p.growing, seed)
+	growthEnd := p.growthEnd
+	growth := p.growth
+	for {
+		p.forgetInvolved(ruleId)
+		p.lexer.SetIndex(index)
+		if seed.match {
+			p.growthEnd = seed.end
+		}
+		p.growths++
+		p.growth = p.growths
+		match := p.evalRule(ruleId, seed.end)
+		p.growthEnd = growthEnd
+		p.growth = growth
+		if !match || p.lexer.Index() <= seed.end {
+			break
+		}
+		seed.match = true
+		seed.end = p.lexer.Index()
+		seed.first = p.arena.sibling(lastNode)
+		if seed.first != noNode {
+			seed.last = p.currentNode
+		} else {
+			seed.last = noNode
+		}
+		p.discardNodes(lastNode)
+	}
+	p.growing = p.growing[:len(p.growing)-1]
+	p.discardNodes(lastNode)
+	p.forgetInvolved(ruleId)
+	if !seed.match {
+		p.lexer.SetIndex(index)
+		return false
+	}
+	p.linkNodes(lastNode, seed.first, seed.last)
+	p.lexer.SetIndex(seed.end)
+	if seed.last != noNode && seed.first == seed.last && p.arena.node(seed.last).ruleType == int32(ruleId) {
+		p.memorized[ruleId] = &memorizedRule{
+			node:  seed.last,
+			start: index,
+			end:   seed.end,
+		}
+	}
+	return true
+}
+
+func (p *Parser) forgetInvolved(ruleId int) {
+	for _, involved := range p.syntax.Involved(ruleId) {
+		p.memorized[involved] = nil
+	}
+}
+
+// linkNodes appends the chain of nodes from first to last after lastNode.
+func (p *Parser) linkNodes(lastNode int32, first int32, last int32) {
+	if first == noNode {
+		return
+	}
+	p.arena.setSibling(last, noNode)
+	p.arena.setSibling(lastNode, first)
+	p.currentNode = last
+}
+
+// discardNodes drops the nodes created after lastNode.
+func (p *Parser) discardNodes(lastNode int32) {
+	p.arena.setSibling(lastNode, noNode)
+	p.currentNode = lastNode
+}
+
 func (p *Parser) skipIgnored(startIndex, endIndex int) int {
 	index := startIndex
 	tkn, err := p.lexer.Token(index)
@@ -128,12 +421,20 @@ func (p *Parser) skipIgnored(startIndex, endIndex int) int {
 	return index
 }
 
-func (p *Parser) createNode(ruleId int, index int, lastNode *ASTNode) {
+func (p *Parser) createNode(ruleId int, index int, lastNode int32) {
 	endIndex := p.lexer.Index() - 1
 	startIndex := p.skipIgnored(index, endIndex)
-	p.currentNode = NewASTNode(ruleId, startIndex, endIndex)
-	p.currentNode.SetFirstChild(lastNode.Sibling())
-	lastNode.SetSibling(p.currentNode)
+	if len(p.recoveries) > 0 {
+		// the tokens skipped by the recovery may end in ignored tokens
+		endIndex = max(p.skipIgnoredBackwards(startIndex, endIndex), startIndex-1)
+	}
+	p.currentNode = p.arena.newNode(ruleId, startIndex, endIndex)
+	p.countNode()
+	p.arena.setFirstChild(p.currentNode, p.arena.sibling(lastNode))
+	p.arena.setSibling(lastNode, p.currentNode)
+	if p.builders != nil {
+		p.buildValue(p.currentNode)
+	}
 	if p.memorized[ruleId] == nil {
 		p.memorized[ruleId] = &memorizedRule{
 			node:  p.currentNode,
@@ -158,12 +459,78 @@ func (p *Parser) parseAndRule(rules []int) bool {
 	return true
 }
 
+// parseOrRule tries the alternatives in order, skipping the ones that can not
+// start with the next token. The token types of a skipped alternative are
+// expected at the next token, as if the alternative were tried.
 func (p *Parser) parseOrRule(rules []int) bool {
+	index := p.lexer.Index()
+	var next *lexer.Token
+	nextIndex := -1
+	if len(p.recoveries) == 0 {
+		next, nextIndex = p.peekToken()
+	}
+	for i, sub := range rules[1:] {
+		if next != nil && !p.syntax.canStartToken(sub, next) {
+			p.reach(nextIndex)
+			for _, tokenType := range p.syntax.Lookahead(sub) {
+				p.expect(nextIndex, tokenType)
+			}
+			continue
+		}
+		if i < len(rules)-2 {
+			if p.parseSpeculativeRule(sub) {
+				return true
+			}
+		} else if p.parseRule(sub) {
+			return true
+		}
+		p.lexer.SetIndex(index)
+	}
+	return false
+}
+
+// peekToken returns the next token not ignored and its index, without moving the
+// lexer. There is no token after the end of input.
+func (p *Parser) peekToken() (*lexer.Token, int) {
+	if p.pastEOI() {
+		return nil, -1
+	}
+	index := p.lexer.Index()
+	defer p.lexer.SetIndex(index)
+	for {
+		tkn, err := p.lexer.NextToken()
+		if err != nil {
+			p.lexFailed(err)
+			return nil, -1
+		}
+		if !p.countToken() {
+			return nil, -1
+		}
+		if !p.lexer.IsIgnored(tkn) {
+			return tkn, p.lexer.Index() - 1
+		}
+		p.skipToken(tkn, p.lexer.Index()-1)
+	}
+}
+
+// pastEOI reports whether the last token read is the end of input.
+func (p *Parser) pastEOI() bool {
+	index := p.lexer.Index() - 1
+	if index < p.lexer.Released() {
+		return false
+	}
+	tkn, err := p.lexer.Token(index)
+	return err == nil && tkn.IsType(lexer.TKN_EOF)
+}
+
+func (p *Parser) parseGrowingOrRule(rules []int, minEnd int) bool {
+	lastNode := p.currentNode
 	index := p.lexer.Index()
 	for _, sub := range rules[1:] {
-		if p.parseRule(sub) {
+		if p.parseRule(sub) && p.lexer.Index() > minEnd {
 			return true
 		}
+		p.discardNodes(lastNode)
 		p.lexer.SetIndex(index)
 	}
 	return false
@@ -176,7 +543,7 @@ func (p *Parser) parseOneOrMoreRule(rules []int) bool {
 		return false
 	}
 	index = p.lexer.Index()
-	for p.parseRule(rules[1]) {
+	for p.parseSpeculativeRule(rules[1]) {
 		index = p.lexer.Index()
 	}
 	p.lexer.SetIndex(index)
@@ -185,7 +552,7 @@ func (p *Parser) parseOneOrMoreRule(rules []int) bool {
 
 func (p *Parser) parseZeroOrMoreRule(rules []int) bool {
 	index := p.lexer.Index()
-	for p.parseRule(rules[1]) {
+	for p.parseSpeculativeRule(rules[1]) {
 		index = p.lexer.Index()
 	}
 	p.lexer.SetIndex(index)
@@ -194,30 +561,32 @@ func (p *Parser) parseZeroOrMoreRule(rules []int) bool {
 
 func (p *Parser) parseOptionalRule(rules []int) bool {
 	index := p.lexer.Index()
-	if !p.parseRule(rules[1]) {
+	if !p.parseSpeculativeRule(rules[1]) {
 		p.lexer.SetIndex(index)
 	}
 	return true
 }
 
 func (p *Parser) parseTestRule(rules []int) bool {
+	lastNode := p.currentNode
 	index := p.lexer.Index()
-	if p.parseRule(rules[1]) {
-		p.lexer.SetIndex(index)
-		return true
-	}
+	p.predicates++
+	match := p.parseRule(rules[1])
+	p.predicates--
+	p.discardNodes(lastNode)
 	p.lexer.SetIndex(index)
-	return false
+	return match
 }
 
 func (p *Parser) parseTestNotRule(rules []int) bool {
+	lastNode := p.currentNode
 	index := p.lexer.Index()
-	if p.parseRule(rules[1]) {
-		p.lexer.SetIndex(index)
-		return false
-	}
+	p.predicates++
+	match := p.parseRule(rules[1])
+	p.predicates--
+	p.discardNodes(lastNode)
 	p.lexer.SetIndex(index)
-	return true
+	return !match
 }
 
 func (p *Parser) parseNonTerminalRule(rules []int) bool {
@@ -233,32 +602,140 @@ func (p *Parser) parseTerminalRule(rules []int) bool {
 	index := p.lexer.Index()
 	tkn, err := p.lexer.NextToken()
 	if err != nil {
-		p.LexError(err)
+		p.lexFailed(err, rules[1])
+		p.lexer.SetIndex(index)
+		return false
+	}
+	if !p.countToken() {
 		p.lexer.SetIndex(index)
 		return false
 	}
 	for p.lexer.IsIgnored(tkn) {
 		if tkn.IsType(rules[1]) {
+			p.reach(p.lexer.Index() - 1)
 			return true
 		}
+		p.skipToken(tkn, p.lexer.Index()-1)
 		tkn, err = p.lexer.NextToken()
 		if err != nil {
-			p.LexError(err)
+			p.lexFailed(err, rules[1])
+			p.lexer.SetIndex(index)
+			return false
+		}
+		if !p.countToken() {
 			p.lexer.SetIndex(index)
 			return false
 		}
 	}
+	p.reach(p.lexer.Index() - 1)
 	if tkn.IsType(rules[1]) {
 		return true
 	}
+	p.expect(p.lexer.Index()-1, rules[1])
 	p.lexer.SetIndex(index)
 	return false
 }
 
+// expect records the token type tried at the token index. Only the token types
+// tried at the farthest index reached are kept to report a syntax error.
+func (p *Parser) expect(tokenIndex int, tokenType int) {
+	if p.predicates > 0 || tokenIndex < p.farthest {
+		return
+	}
+	if tokenIndex > p.farthest {
+		p.farthest = tokenIndex
+		p.expected = p.expected[:0]
+	}
+	for _, expected := range p.expected {
+		if expected == tokenType {
+			return
+		}
+	}
+	p.expected = append(p.expected, tokenType)
+}
+
+// lexFailed reports the error of the lexer reading the next token and records
+// the token types as expected where the lexer failed, so the syntax error is not
+// reported at a token read after the invalid characters.
+func (p *Parser) lexFailed(lexError error.Error, tokenTypes ...int) {
+	p.LexError(lexError)
+	if lexError.Code() == lexer.LEX_ERROR_EOF {
+		return
+	}
+	failedAt := p.lexer.Index()
+	p.reach(failedAt)
+	if p.predicates == 0 && failedAt > p.farthest {
+		p.farthest = failedAt
+		p.expected = p.expected[:0]
+	}
+	for _, tokenType := range tokenTypes {
+		p.expect(failedAt, tokenType)
+	}
+	if failedAt >= p.lexFailedAt {
+		p.lexFailedAt = failedAt
+		p.lexFailure = lexError
+	}
+}
+
+func (p *Parser) syntaxError() {
+	if p.farthest < 0 {
+		return
+	}
+	if p.farthest == p.lexFailedAt {
+		if len(p.expected) == 0 {
+			// the lexer error is reported already
+			return
+		}
+		p.Error(SYNTAX_ERROR, p.lexFailure.Row(), p.lexFailure.Col(), p.expectedMessage()+" but found an invalid character")
+		return
+	}
+	tkn, err := p.lexer.Token(p.farthest)
+	if err != nil {
+		return
+	}
+	message := strings.Builder{}
+	message.WriteString(p.expectedMessage())
+	message.WriteString(" but found ")
+	if tkn.IsType(lexer.TKN_EOF) {
+		message.WriteString("end of input")
+	} else {
+		message.WriteString(p.syntax.TokenLabel(tkn.Type(0)))
+	}
+	p.Error(SYNTAX_ERROR, tkn.Row(), tkn.Col(), message.String())
+}
+
+// expectedMessage lists the token types expected at the farthest index.
+func (p *Parser) expectedMessage() string {
+	message := strings.Builder{}
+	message.WriteString("expected ")
+	for i, tokenType := range p.expected {
+		if i > 0 {
+			if i == len(p.expected)-1 {
+				message.WriteString(" or ")
+			} else {
+				message.WriteString(", ")
+			}
+		}
+		message.WriteString(p.syntax.TokenLabel(tokenType))
+	}
+	return message.String()
+}
+
 func (p *Parser) LexError(lexError error.Error) {
 	p.errors = append(p.errors, lexError)
 }
 
+// skipToken is called for each ignored token skipped by the parser, reporting
+// the error tokens of the lexer, each one the first time it is skipped.
+func (p *Parser) skipToken(tkn *lexer.Token, tokenIndex int) {
+	if tokenIndex <= p.errorToken || !tkn.IsType(p.lexer.Vocabulary().ErrorType()) {
+		return
+	}
+	p.errorToken = tokenIndex
+	text := p.lexer.Input().GetText(tkn.Index(), tkn.Index()+tkn.Len())
+	p.Error(INVALID_TOKEN_ERROR, tkn.Row(), tkn.Col(), "invalid characters '"+text+"' skipped")
+}
+
 func (p *Parser) Error(errorCode int, row int, col int, message string) {
 	err := &ParserError{
 		code:    errorCode,
@@ -276,17 +753,50 @@ func (p *Parser) NodeTokens(node *ASTNode) (*lexer.Token, *lexer.Token) {
 }
 
 func (p *Parser) NodeText(node *ASTNode) string {
-	startToken, endToken := p.NodeTokens(node)
-	if startToken == nil || endToken == nil {
+	if node.EndToken() < node.StartToken() {
+		return ""
+	}
+	return p.tokensText(node.StartToken(), node.EndToken())
+}
+
+// tokensText returns the text of the input from the start to the end token
+// index, or an empty text when the tokens can not be read.
+func (p *Parser) tokensText(start int, end int) string {
+	startToken, err := p.lexer.Token(start)
+	if err != nil {
+		return ""
+	}
+	endToken, err := p.lexer.Token(end)
+	if err != nil {
 		return ""
 	}
 	return p.lexer.Input().GetText(startToken.Index(), endToken.Index()+endToken.Len())
 }
 
 func (p *Parser) Position(node *ASTNode) (int, int) {
-	token, _ := p.lexer.Token(node.StartToken())
-	if token == nil {
+	token, err := p.lexer.Token(node.StartToken())
+	if err != nil {
 		return 0, 0
 	}
 	return token.Row(), token.Col()
 }
+
+// TokenIndexAt returns the index of the token at the row and column of the input,
+// or -1 when the position is before the first token.
+func (p *Parser) TokenIndexAt(row int, col int) int {
+	end := p.lexer.ReadAll()
+	released := p.lexer.Released()
+	return released + sort.Search(end-released, func(i int) bool {
+		tkn, _ := p.lexer.Token(released + i)
+		return tkn.Row() > row || (tkn.Row() == row && tkn.Col() > col)
+	}) - 1
+}
+
+// NodeAt returns the deepest node under root that covers the token at the row and column.
+func (p *Parser) NodeAt(root *ASTNode, row int, col int) *ASTNode {
+	tokenIndex := p.TokenIndexAt(row, col)
+	if tokenIndex < 0 {
+		return nil
+	}
+	return root.NodeAtToken(tokenIndex)
+}
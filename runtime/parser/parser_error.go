@@ -15,7 +15,23 @@ type ParserError struct {
 
 const LEXER_ERROR = 1
 
+// The codes of the errors found by the parser start at PARSER_ERRORS, apart
+// from the codes of the lexer errors, which are reported by Errors too.
+const PARSER_ERRORS = 100
+
+const (
+	SYNTAX_ERROR = PARSER_ERRORS + iota
+	CANCELED_ERROR
+	DEPTH_LIMIT_ERROR
+	TOKENS_LIMIT_ERROR
+	NODES_LIMIT_ERROR
+	BACKTRACKS_LIMIT_ERROR
+	INVALID_TOKEN_ERROR
+)
+
 var _ error.Error = &ParserError{}
+var _ error.Error = &LimitError{}
+var _ error.Error = &CanceledError{}
 
 // Code implements error.Error.
 func (p *ParserError) Code() int {
@@ -0,0 +1,36 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// newParser builds the parser of the grammar for the source.
+func newParser(t testing.TB, grammarSource string, source string) *parser.Parser {
+	t.Helper()
+	g, err := grammar.FromString(grammarSource)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	return parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+}
+
+// treeString writes the rule names of the node and its descendants with the text they cover.
+func treeString(p *parser.Parser, node *parser.ASTNode) string {
+	text := ""
+	for child := node.FirstChild(); child != nil; child = child.Sibling() {
+		text += p.Syntax().RuleName(child.RuleType()) + "(" + p.NodeText(child)
+		if child.FirstChild() != nil {
+			text += " " + treeString(p, child)
+		}
+		text += ")"
+	}
+	return text
+}
@@ -0,0 +1,228 @@
+package parser
+
+import "github.com/fabiouggeri/page/runtime/lexer"
+
+// sequence is the element being parsed by a sequence or by a repetition while recovering from errors.
+type sequence struct {
+	rule       int
+	element    int
+	repetition bool
+}
+
+const maxRecoveries = 1000
+
+// SetRecovery enables the error recovery. When the parsing fails, the input is parsed
+// again and the elements failing at the farthest position skip the tokens up to one
+// of their follow tokens. The skipped tokens are kept in error nodes.
+func (p *Parser) SetRecovery(recovery bool) {
+	p.recovery = recovery
+}
+
+func (p *Parser) Recovery() bool {
+	return p.recovery
+}
+
+func (p *Parser) canRecover() bool {
+	if !p.recovery || p.listener != nil || p.aborted != nil || p.farthest < 0 || len(p.recoveries) >= maxRecoveries {
+		return false
+	}
+	return len(p.recoveries) == 0 || p.farthest > p.recoveries[len(p.recoveries)-1]
+}
+
+func (p *Parser) reach(tokenIndex int) {
+	if tokenIndex > p.reached {
+		p.reached = tokenIndex
+	}
+}
+
+func (p *Parser) parseRecoverableAndRule(ruleId int, rules []int) bool {
+	index := p.lexer.Index()
+	p.sequences = append(p.sequences, sequence{rule: ruleId})
+	defer p.popSequence()
+	for _, sub := range rules[1:] {
+		p.sequences[len(p.sequences)-1].element = sub
+		lastNode := p.currentNode
+		start := p.lexer.Index()
+		reached := p.reached
+		p.reached = -1
+		match := p.parseRule(sub)
+		if !match {
+			syncIndex, own, restart := p.findSync(start, p.syntax.Follow(ruleId, sub), p.syntax.First(sub))
+			if restart {
+				p.errorNode(lastNode, start, syncIndex)
+				match = p.parseRule(sub)
+			} else if own && syncIndex > index {
+				p.errorNode(lastNode, start, syncIndex)
+				match = true
+			}
+		}
+		p.reach(reached)
+		if !match {
+			p.lexer.SetIndex(index)
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Parser) parseRecoverableZeroOrMoreRule(ruleId int, rules []int) bool {
+	p.sequences = append(p.sequences, sequence{rule: ruleId, element: rules[1], repetition: true})
+	defer p.popSequence()
+	for {
+		lastNode := p.currentNode
+		start := p.lexer.Index()
+		reached := p.reached
+		p.reached = -1
+		match := p.parseRule(rules[1])
+		p.reach(reached)
+		if match {
+			continue
+		}
+		syncIndex, own, _ := p.findSync(start, p.syntax.First(rules[1]), nil)
+		if syncIndex <= start {
+			p.lexer.SetIndex(start)
+			return true
+		}
+		p.errorNode(lastNode, start, syncIndex)
+		if !own {
+			return true
+		}
+	}
+}
+
+func (p *Parser) parseRecoverableOneOrMoreRule(ruleId int, rules []int) bool {
+	index := p.lexer.Index()
+	if !p.parseRule(rules[1]) {
+		p.lexer.SetIndex(index)
+		return false
+	}
+	return p.parseRecoverableZeroOrMoreRule(ruleId, rules)
+}
+
+func (p *Parser) popSequence() {
+	p.sequences = p.sequences[:len(p.sequences)-1]
+}
+
+// findSync looks for the token where the parsing resumes, starting at the recovery
+// point reached by the element started at the token index start. It returns -1 when
+// the element did not reach a recovery point. The token found is owned by the element
+// when it belongs to the follow set of the element and is not owned when it follows an
+// enclosing sequence, so that the enclosing sequence recovers. A token after the
+// recovery point, and before the follow tokens, in the first set of the failed element
+// restarts the element there, so the tokens of the element are not skipped. An
+// element that failed again after the recovery point does not recover, so the
+// parsing fails and the next pass recovers from the new error.
+func (p *Parser) findSync(start int, follow []int, first []int) (int, bool, bool) {
+	at := p.recoveryPoint(start)
+	if at < 0 || p.reached > at || p.aborted != nil || p.predicates > 0 || start <= p.growthEnd {
+		return -1, false, false
+	}
+	outermost := len(p.sequences) == 1
+	for index := at; ; index++ {
+		tkn, err := p.lexer.Token(index)
+		if err != nil {
+			return -1, false, false
+		}
+		if p.lexer.IsIgnored(tkn) {
+			continue
+		}
+		if index > at && p.isFollow(tkn, first) {
+			return index, true, true
+		}
+		eof := tkn.IsType(lexer.TKN_EOF)
+		if p.owns(tkn, follow) || (eof && outermost) {
+			return index, true, false
+		}
+		if eof || p.followsEnclosing(tkn) {
+			return index, false, false
+		}
+	}
+}
+
+// recoveryPoint returns the last recovery point reached by the element started at the token index.
+func (p *Parser) recoveryPoint(start int) int {
+	for i := len(p.recoveries) - 1; i >= 0; i-- {
+		at := p.recoveries[i]
+		if at >= start && at <= p.reached {
+			return at
+		}
+	}
+	return -1
+}
+
+// errorNode replaces the nodes created after lastNode by an error node covering
+// the tokens from start up to the token before syncIndex, without the ignored
+// tokens at both ends. No error node is created when only ignored tokens are skipped.
+func (p *Parser) errorNode(lastNode int32, start int, syncIndex int) {
+	p.discardNodes(lastNode)
+	p.lexer.SetIndex(syncIndex)
+	start = p.skipIgnored(start, syncIndex)
+	end := p.skipIgnoredBackwards(start, syncIndex-1)
+	if end < start {
+		return
+	}
+	node := p.arena.newNode(ERROR_RULE, start, end)
+	p.countNode()
+	p.arena.setSibling(lastNode, node)
+	p.currentNode = node
+}
+
+// skipIgnoredBackwards returns the index of the last token not ignored from
+// endIndex back to startIndex, or startIndex less one when all are ignored.
+func (p *Parser) skipIgnoredBackwards(startIndex, endIndex int) int {
+	index := endIndex
+	for index >= startIndex {
+		tkn, err := p.lexer.Token(index)
+		if err != nil || !p.lexer.IsIgnored(tkn) {
+			return index
+		}
+		index--
+	}
+	return index
+}
+
+// owns reports whether the token follows the failed element. The last element of
+// a sequence has no follow set of its own, so it takes the follow set of the
+// nearest enclosing element that is not at the end of its sequence. An enclosing
+// repetition is followed by its element or by what follows the repetition.
+func (p *Parser) owns(tkn *lexer.Token, follow []int) bool {
+	if len(follow) > 0 {
+		return p.isFollow(tkn, follow)
+	}
+	for i := len(p.sequences) - 2; i >= 0; i-- {
+		s := p.sequences[i]
+		if s.repetition {
+			if p.isFollow(tkn, p.syntax.First(s.element)) {
+				return true
+			}
+			continue
+		}
+		if follow = p.syntax.Follow(s.rule, s.element); len(follow) > 0 {
+			return p.isFollow(tkn, follow)
+		}
+	}
+	return tkn.IsType(lexer.TKN_EOF)
+}
+
+func (p *Parser) followsEnclosing(tkn *lexer.Token) bool {
+	for _, s := range p.sequences[:len(p.sequences)-1] {
+		if s.repetition {
+			if p.isFollow(tkn, p.syntax.First(s.element)) {
+				return true
+			}
+		} else if p.isFollow(tkn, p.syntax.Follow(s.rule, s.element)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Parser) isFollow(tkn *lexer.Token, follow []int) bool {
+	for _, ruleId := range follow {
+		rules := p.syntax.Subrules(ruleId)
+		if ParserRuleType(rules[0]) == TERMINAL_RULE && tkn.IsType(rules[1]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package parser_test
+
+import (
+	"slices"
+	"testing"
+)
+
+const recoveryGrammar = `grammar Recovery;
+
+Program : Stmt* EOI;
+
+Stmt : Ident '=' Expr ';';
+
+Expr : Term ('+' Term)*;
+
+Term : Ident | Number;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+Dollar : '$';
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+func TestRecovery(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		tree   string
+		errors []string
+	}{
+		{
+			name:   "sync on the end of statement",
+			source: "a = 1 $ 2; ",
+			tree:   "Stmt(a = 1 $ 2; Expr(1 $ 2 Term(1)Error($)Term(2)))",
+			errors: []string{"expected '+' or ';' but found '$'"},
+		},
+		{
+			name:   "restart the failed element",
+			source: "a = $ b; c = 1;",
+			tree:   "Stmt(a = $ b; Expr($ b Error($)Term(b)))Stmt(c = 1; Expr(1 Term(1)))",
+			errors: []string{"expected Ident or Number but found '$'"},
+		},
+		{
+			name:   "sync on the follow of the failed element",
+			source: "a = 1 + $; c = 1;",
+			tree:   "Stmt(a = 1 + $; Expr(1 + $ Term(1)Error($)))Stmt(c = 1; Expr(1 Term(1)))",
+			errors: []string{"expected Ident or Number but found '$'"},
+		},
+		{
+			name:   "multiple errors",
+			source: "a = 1 $ 2; b = 3 4; c = 5 $$ 6",
+			tree:   "Stmt(a = 1 $ 2; Expr(1 $ 2 Term(1)Error($)Term(2)))Stmt(b = 3 4; Expr(3 4 Term(3)Term(4)))Stmt(c = 5 $$ 6 Expr(5 $$ 6 Term(5)Error($$)Term(6)))",
+			errors: []string{
+				"expected '+' or ';' but found '$'",
+				"expected '+' or ';' but found Number",
+				"expected '+' or ';' but found '$'",
+				"expected '+' or ';' but found end of input",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newParser(t, recoveryGrammar, test.source)
+			p.SetRecovery(true)
+			root := p.Execute()
+			if root == nil {
+				t.Fatalf("recovery failed: %v", p.Errors())
+			}
+			if got := treeString(p, root); got != test.tree {
+				t.Errorf("got tree %s, want %s", got, test.tree)
+			}
+			errors := make([]string, 0)
+			for _, err := range p.Errors() {
+				errors = append(errors, err.Message())
+			}
+			if !slices.Equal(errors, test.errors) {
+				t.Errorf("got errors %q, want %q", errors, test.errors)
+			}
+		})
+	}
+}
+
+// TestRecoverySpans checks that the nodes recovered and the error nodes do not
+// end in ignored tokens and that the error nodes leave the sync token to the
+// enclosing rule.
+func TestRecoverySpans(t *testing.T) {
+	p := newParser(t, recoveryGrammar, "a = 1 $ 2 ; b = 1 + \n $ ; ")
+	p.SetRecovery(true)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("recovery failed: %v", p.Errors())
+	}
+	for node := range root.Descendants() {
+		for _, index := range []int{node.StartToken(), node.EndToken()} {
+			tkn, err := p.Lexer().Token(index)
+			if err != nil || p.Lexer().IsIgnored(tkn) {
+				t.Errorf("node %q has the ignored token %d at one end", p.NodeText(node), index)
+			}
+		}
+		if node.IsError() && p.NodeText(node) != "$" {
+			t.Errorf("got error node %q, want $", p.NodeText(node))
+		}
+	}
+	statements := root.Children()
+	if len(statements) != 2 || p.NodeText(statements[0]) != "a = 1 $ 2 ;" || p.NodeText(statements[1]) != "b = 1 + \n $ ;" {
+		t.Errorf("got statements %s", treeString(p, root))
+	}
+}
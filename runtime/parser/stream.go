@@ -0,0 +1,154 @@
+package parser
+
+// Listener receives the events of a streaming parse, in the order of the input.
+type Listener interface {
+	// EnterRule is called before the events of the tokens and rules matched by the rule.
+	EnterRule(p *Parser, ruleId int)
+	// ExitRule is called after the events of the tokens and rules matched by the
+	// rule. The node gives the tokens matched and is not kept by the parser. Its
+	// children, if any, were already reported and must not be used.
+	ExitRule(p *Parser, node *ASTNode)
+	// Token is called for each token matched that is not ignored.
+	Token(p *Parser, tokenIndex int)
+}
+
+// SetListener enables the streaming mode when the listener is not nil. In this
+// mode the parser reports the rules and tokens matched to the listener as soon
+// as their match is final, that is, when no enclosing choice, repetition or
+// option can discard it anymore, and drops them instead of building a tree.
+// Rules matched while the match is not final are kept until it is. When a match
+// is reported with no rule open but the start rule, like a statement of a
+// program, the lexer releases its tokens, so the memory used depends on the
+// size of the largest statement and not on the size of the input. The tokens of
+// the start rule are released by then, so its node gives no text, and the input
+// can not be parsed again. The events of
+// the matches before a syntax error are reported anyway. Error recovery is
+// disabled in this mode, and Execute returns a node of the start rule without
+// children.
+func (p *Parser) SetListener(listener Listener) {
+	p.listener = listener
+}
+
+func (p *Parser) Listener() Listener {
+	return p.listener
+}
+
+// streaming reports whether the rules parsed now have final matches.
+func (p *Parser) streaming() bool {
+	return p.listener != nil && p.speculative == 0 && p.predicates == 0
+}
+
+// parseStreamedRule parses a rule whose match is final, reporting it without
+// keeping its node.
+func (p *Parser) parseStreamedRule(ruleId int) bool {
+	p.flush()
+	reported := !p.ignore && !p.syntax.IsSubRule(ruleId) && !p.syntax.HasOption(ruleId, SKIP_NODE|IGNORE) &&
+		ParserRuleType(p.syntax.Subrules(ruleId)[0]) != TERMINAL_RULE
+	if reported {
+		p.listener.EnterRule(p, ruleId)
+		p.streamDepth++
+	}
+	lastNode := p.currentNode
+	if !p.evalRule(ruleId, -1) {
+		if reported {
+			p.streamDepth--
+		}
+		return false
+	}
+	if reported && p.currentNode != lastNode {
+		node := p.currentNode
+		firstChild := p.arena.firstChild(node)
+		p.linkNodes(lastNode, firstChild, p.lastChainNode(firstChild))
+		if firstChild == noNode {
+			p.discardNodes(lastNode)
+		}
+		p.arena.setFirstChild(node, noNode)
+		view := p.arena.view(node)
+		p.flush()
+		p.streamDepth--
+		p.listener.ExitRule(p, view)
+		p.release()
+		p.streamed = view
+		return true
+	}
+	p.flush()
+	if reported {
+		p.streamDepth--
+	}
+	return true
+}
+
+// parseSpeculativeRule parses a rule whose match may still be discarded by the
+// rule calling it, reporting the match when it becomes final.
+func (p *Parser) parseSpeculativeRule(ruleId int) bool {
+	p.speculative++
+	match := p.parseRule(ruleId)
+	p.speculative--
+	if match && p.streaming() {
+		p.flush()
+	}
+	return match
+}
+
+// flush reports the nodes waiting after the head of the stream and the tokens
+// matched up to the current position.
+func (p *Parser) flush() {
+	for node := p.arena.sibling(p.streamHead); node != noNode; node = p.arena.sibling(node) {
+		for event, id := range p.arena.traverse(node) {
+			n := p.arena.node(id)
+			switch {
+			case n.token:
+				if event == ENTER_NODE {
+					p.reportTokens(int(n.startToken))
+				}
+			case event == ENTER_NODE:
+				p.reportTokens(int(n.startToken) - 1)
+				p.listener.EnterRule(p, int(n.ruleType))
+			default:
+				p.reportTokens(int(n.endToken))
+				p.listener.ExitRule(p, p.arena.view(id))
+			}
+		}
+	}
+	p.discardNodes(p.streamHead)
+	p.reportTokens(p.lexer.Index() - 1)
+	p.release()
+}
+
+// release drops the tokens reported when no rule is open but the start rule,
+// since the nodes that need them were reported already. The nodes reported are
+// dropped too, once they fill a block, with the results memoized that may use
+// them.
+func (p *Parser) release() {
+	if p.streamDepth > 1 {
+		return
+	}
+	p.lexer.Release(p.streamIndex)
+	if p.currentNode == p.streamHead && p.arena.len() > nodesBlockSize {
+		clear(p.memorized)
+		if p.memo != nil {
+			p.memo.clearEntries()
+		}
+		p.arena.truncate(int(p.streamHead) + 1)
+	}
+}
+
+// reportTokens reports the tokens not ignored up to the token index.
+func (p *Parser) reportTokens(tokenIndex int) {
+	for ; p.streamIndex <= tokenIndex; p.streamIndex++ {
+		tkn, err := p.lexer.Token(p.streamIndex)
+		if err != nil {
+			return
+		}
+		if !p.lexer.IsIgnored(tkn) {
+			p.listener.Token(p, p.streamIndex)
+		}
+	}
+}
+
+func (p *Parser) lastChainNode(node int32) int32 {
+	for node != noNode && p.arena.sibling(node) != noNode {
+		node = p.arena.sibling(node)
+	}
+	return node
+}
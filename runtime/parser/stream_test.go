@@ -0,0 +1,138 @@
+package parser_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+const streamGrammar = `grammar Stream;
+
+Program : Stmt* EOI;
+
+Stmt : Ident '=' Expr ';';
+
+Expr : Term ('+' Term)*;
+
+Term : Ident | Number;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// statements writes the count of assignments of the stream grammar.
+func statements(count int) string {
+	source := strings.Builder{}
+	for i := range count {
+		fmt.Fprintf(&source, "v = a + %d + b;\n", i)
+	}
+	return source.String()
+}
+
+// stmtListener counts the statements reported and the most tokens kept by the
+// lexer at the end of a statement.
+type stmtListener struct {
+	stmtRule   int
+	statements int
+	maxKept    int
+	texts      []string
+	sample     func()
+}
+
+func (l *stmtListener) EnterRule(p *parser.Parser, ruleId int) {
+}
+
+func (l *stmtListener) ExitRule(p *parser.Parser, node *parser.ASTNode) {
+	if node.RuleType() != l.stmtRule {
+		return
+	}
+	l.statements++
+	l.maxKept = max(l.maxKept, p.Lexer().Index()-p.Lexer().Released())
+	if len(l.texts) < 2 {
+		l.texts = append(l.texts, p.NodeText(node))
+	}
+	if l.sample != nil && l.statements%1000 == 0 {
+		l.sample()
+	}
+}
+
+func (l *stmtListener) Token(p *parser.Parser, tokenIndex int) {
+}
+
+func TestStreamReleasesTokens(t *testing.T) {
+	p := newParser(t, streamGrammar, statements(1000))
+	listener := &stmtListener{stmtRule: p.Syntax().RuleId("Stmt")}
+	p.SetListener(listener)
+	if p.Execute() == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	if listener.statements != 1000 {
+		t.Errorf("got %d statements, want 1000", listener.statements)
+	}
+	if listener.maxKept > 20 {
+		t.Errorf("the lexer kept %d tokens at the end of a statement, want at most 20", listener.maxKept)
+	}
+	want := []string{"v = a + 0 + b;", "v = a + 1 + b;"}
+	if strings.Join(listener.texts, "|") != strings.Join(want, "|") {
+		t.Errorf("got statements %q, want %q", listener.texts, want)
+	}
+}
+
+// liveHeap returns the bytes of the heap in use after a garbage collection.
+func liveHeap() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// heapGrowth returns the bytes of the heap in use more than the base.
+func heapGrowth(base uint64) uint64 {
+	return max(liveHeap(), base) - base
+}
+
+// BenchmarkStreamMemory reports the most heap in use while the statements are
+// streamed, not counting the input, which should not grow with the count of
+// statements, and the heap in use by the tree of the same input.
+func BenchmarkStreamMemory(b *testing.B) {
+	for _, count := range []int{10000, 100000} {
+		source := statements(count)
+		b.Run(fmt.Sprintf("stream-%d", count), func(b *testing.B) {
+			var peak uint64
+			for range b.N {
+				p := newParser(b, streamGrammar, source)
+				base := liveHeap()
+				listener := &stmtListener{stmtRule: p.Syntax().RuleId("Stmt")}
+				listener.sample = func() {
+					peak = max(peak, heapGrowth(base))
+				}
+				p.SetListener(listener)
+				if p.Execute() == nil {
+					b.Fatalf("parse failed: %v", p.Errors())
+				}
+			}
+			b.ReportMetric(float64(peak), "peak-heap-B")
+		})
+		b.Run(fmt.Sprintf("tree-%d", count), func(b *testing.B) {
+			var used uint64
+			for range b.N {
+				p := newParser(b, streamGrammar, source)
+				base := liveHeap()
+				root := p.Execute()
+				if root == nil {
+					b.Fatalf("parse failed: %v", p.Errors())
+				}
+				used = max(used, heapGrowth(base))
+				runtime.KeepAlive(root)
+			}
+			b.ReportMetric(float64(used), "peak-heap-B")
+		})
+	}
+}
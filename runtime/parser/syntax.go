@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"strconv"
 	"strings"
 
+	"github.com/fabiouggeri/page/runtime/lexer"
 	"github.com/fabiouggeri/page/util"
 )
 
@@ -13,10 +15,13 @@ type Syntax struct {
 	startRule       int
 	lastNonTerminal int
 	rulesNames      []string
+	rulesLabels     []string
 	rulesTable      [][]int
 	rulesOptions    []ParserRuleOption
 	firstTable      [][]int
+	lookaheadTable  [][]int
 	followTables    []FollowTable
+	involvedTable   [][]int
 }
 
 type FollowTable struct {
@@ -40,9 +45,10 @@ const (
 )
 
 const (
-	SKIP_NODE ParserRuleOption = 0x0001
-	MEMOIZE   ParserRuleOption = 0x0002
-	IGNORE    ParserRuleOption = 0x0004
+	SKIP_NODE      ParserRuleOption = 0x0001
+	MEMOIZE        ParserRuleOption = 0x0002
+	IGNORE         ParserRuleOption = 0x0004
+	LEFT_RECURSIVE ParserRuleOption = 0x0008
 )
 
 func SyntaxNew(totalRules int, lastNonTerminal int) *Syntax {
@@ -50,10 +56,13 @@ func SyntaxNew(totalRules int, lastNonTerminal int) *Syntax {
 		startRule:       -1,
 		lastNonTerminal: lastNonTerminal,
 		rulesNames:      make([]string, totalRules),
+		rulesLabels:     make([]string, totalRules),
 		rulesTable:      make([][]int, totalRules),
 		rulesOptions:    make([]ParserRuleOption, totalRules),
 		firstTable:      make([][]int, totalRules),
+		lookaheadTable:  make([][]int, totalRules),
 		followTables:    make([]FollowTable, totalRules),
+		involvedTable:   make([][]int, totalRules),
 	}
 }
 
@@ -90,9 +99,39 @@ func (s *Syntax) Subrules(ruleId int) []int {
 }
 
 func (s *Syntax) RuleName(ruleId int) string {
+	if ruleId == ERROR_RULE {
+		return "Error"
+	} else if ruleId < 0 || ruleId >= len(s.rulesNames) {
+		return ""
+	}
+	return s.rulesNames[ruleId]
+}
+
+// SetLabel sets the text used to show the rule in messages, like the literal matched by a terminal rule.
+func (s *Syntax) SetLabel(ruleId int, label string) {
+	s.rulesLabels[ruleId] = label
+}
+
+func (s *Syntax) RuleLabel(ruleId int) string {
+	if s.rulesLabels[ruleId] != "" {
+		return s.rulesLabels[ruleId]
+	}
 	return s.rulesNames[ruleId]
 }
 
+// TokenLabel returns the label of the terminal rule that matches the token type.
+func (s *Syntax) TokenLabel(tokenType int) string {
+	if tokenType == lexer.TKN_EOF {
+		return "end of input"
+	}
+	for i, rules := range s.rulesTable {
+		if ParserRuleType(rules[0]) == TERMINAL_RULE && rules[1] == tokenType {
+			return s.RuleLabel(i)
+		}
+	}
+	return "token " + strconv.Itoa(tokenType)
+}
+
 func (s *Syntax) RuleId(name string) int {
 	for i, ruleName := range s.rulesNames {
 		if strings.EqualFold(ruleName, name) {
@@ -108,10 +147,93 @@ func (s *Syntax) SetFollow(ruleId int, follow []RuleFollow) {
 	}
 }
 
+func (s *Syntax) AddFollow(ruleId int, follow RuleFollow) {
+	s.followTables[ruleId].rulesFollow = append(s.followTables[ruleId].rulesFollow, follow)
+}
+
+// Follow returns the terminal rules that may follow the subrule inside the rule.
+func (s *Syntax) Follow(ruleId int, subruleId int) []int {
+	for _, follow := range s.followTables[ruleId].rulesFollow {
+		if follow.rule == subruleId {
+			return follow.rulesFollow
+		}
+	}
+	return nil
+}
+
+func (s *Syntax) HasFollow(ruleId int) bool {
+	return len(s.followTables[ruleId].rulesFollow) > 0
+}
+
 func (s *Syntax) SetFirst(ruleId int, firstIds []int) {
 	s.firstTable[ruleId] = firstIds
 }
 
+// SetInvolved stores the rules that take part in the left recursion of ruleId,
+// that is, the rules that may be called again at the position where ruleId started.
+func (s *Syntax) SetInvolved(ruleId int, involvedIds []int) {
+	s.involvedTable[ruleId] = involvedIds
+}
+
+func (s *Syntax) Involved(ruleId int) []int {
+	return s.involvedTable[ruleId]
+}
+
+func (s *Syntax) IsInvolved(ruleId int, involvedId int) bool {
+	for _, id := range s.involvedTable[ruleId] {
+		if id == involvedId {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Syntax) First(ruleId int) []int {
+	return s.firstTable[ruleId]
+}
+
+// SetLookahead stores the token types that can start a match of the rule. A nil
+// lookahead means that the rule must be tried whatever the next token is.
+func (s *Syntax) SetLookahead(ruleId int, tokenTypes []int) {
+	s.lookaheadTable[ruleId] = tokenTypes
+}
+
+func (s *Syntax) Lookahead(ruleId int) []int {
+	return s.lookaheadTable[ruleId]
+}
+
+// CanStart reports whether the rule can start with a token of any of the types.
+func (s *Syntax) CanStart(ruleId int, tokenTypes []int) bool {
+	lookahead := s.lookaheadTable[ruleId]
+	if lookahead == nil {
+		return true
+	}
+	for _, tokenType := range tokenTypes {
+		for _, startType := range lookahead {
+			if startType == tokenType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canStartToken reports whether the rule can start with the token.
+func (s *Syntax) canStartToken(ruleId int, tkn *lexer.Token) bool {
+	lookahead := s.lookaheadTable[ruleId]
+	if lookahead == nil {
+		return true
+	}
+	for i := range tkn.TypesCount() {
+		for _, startType := range lookahead {
+			if startType == tkn.Type(i) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s *Syntax) IsSubRule(index int) bool {
 	return index > s.lastNonTerminal
 }
@@ -193,6 +315,24 @@ func (s *Syntax) Write(writer *util.StringCodeWriter) {
 		}
 		writer.NewLine()
 	}
+	writer.NewLine().WriteString("Left Recursion:").
+		NewLine().
+		WriteString("===============").
+		NewLine()
+	for i := range s.involvedTable {
+		if !s.HasOption(i, LEFT_RECURSIVE) {
+			continue
+		}
+		ruleName = s.rulesNames[i]
+		writer.WriteString(ruleName).WriteString(" -> ")
+		for j, involvedRule := range s.involvedTable[i] {
+			if j > 0 {
+				writer.WriteString(", ")
+			}
+			writer.WriteString(s.rulesNames[involvedRule])
+		}
+		writer.NewLine()
+	}
 }
 
 func ruleType(ruleType int) string {
@@ -0,0 +1,77 @@
+package parser
+
+import "iter"
+
+// TraversalEvent tells whether a traversal is entering or exiting a node.
+type TraversalEvent int
+
+const (
+	ENTER_NODE TraversalEvent = iota
+	EXIT_NODE
+)
+
+// The traversals below keep their own stack instead of recursing, so they can
+// walk trees of any depth.
+
+// PreOrder iterates over the node and its descendants, each node before its children.
+func (n *ASTNode) PreOrder() iter.Seq[*ASTNode] {
+	return func(yield func(*ASTNode) bool) {
+		arena := n.arena
+		stack := []int32{n.id}
+		for len(stack) > 0 {
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !yield(arena.view(node)) {
+				return
+			}
+			if node != n.id && arena.node(node).sibling != noNode {
+				stack = append(stack, arena.node(node).sibling)
+			}
+			if arena.node(node).firstChild != noNode {
+				stack = append(stack, arena.node(node).firstChild)
+			}
+		}
+	}
+}
+
+// PostOrder iterates over the node and its descendants, each node after its children.
+func (n *ASTNode) PostOrder() iter.Seq[*ASTNode] {
+	return func(yield func(*ASTNode) bool) {
+		for event, node := range n.Traverse() {
+			if event == EXIT_NODE && !yield(node) {
+				return
+			}
+		}
+	}
+}
+
+// BreadthFirst iterates over the node and its descendants level by level.
+func (n *ASTNode) BreadthFirst() iter.Seq[*ASTNode] {
+	return func(yield func(*ASTNode) bool) {
+		arena := n.arena
+		queue := []int32{n.id}
+		for len(queue) > 0 {
+			node := queue[0]
+			queue = queue[1:]
+			if !yield(arena.view(node)) {
+				return
+			}
+			for child := arena.node(node).firstChild; child != noNode; child = arena.node(child).sibling {
+				queue = append(queue, child)
+			}
+		}
+	}
+}
+
+// Traverse iterates over the node and its descendants in depth-first order,
+// yielding ENTER_NODE before the children of each node and EXIT_NODE after them.
+func (n *ASTNode) Traverse() iter.Seq2[TraversalEvent, *ASTNode] {
+	return func(yield func(TraversalEvent, *ASTNode) bool) {
+		arena := n.arena
+		for event, node := range arena.traverse(n.id) {
+			if !yield(event, arena.view(node)) {
+				return
+			}
+		}
+	}
+}
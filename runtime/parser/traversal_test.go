@@ -0,0 +1,143 @@
+package parser_test
+
+import (
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// firstNodes returns the first count nodes of the sequence, breaking the loop
+// after them.
+func firstNodes(nodes iter.Seq[*parser.ASTNode], count int) []*parser.ASTNode {
+	first := make([]*parser.ASTNode, 0, count)
+	for node := range nodes {
+		if len(first) == count {
+			break
+		}
+		first = append(first, node)
+	}
+	return first
+}
+
+func TestTraversals(t *testing.T) {
+	p := newParser(t, streamGrammar, navigationSource)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	first := root.FirstChild()
+	expr := first.FirstChild()
+	term := expr.LastChild()
+	tests := []struct {
+		name  string
+		nodes iter.Seq[*parser.ASTNode]
+		want  []string
+	}{
+		{
+			name:  "pre-order",
+			nodes: root.PreOrder(),
+			want:  []string{"Program " + navigationSource, "Stmt a = 1 + b;", "Expr 1 + b", "Term 1", "Term b", "Stmt c = 2;", "Expr 2", "Term 2"},
+		},
+		{name: "pre-order of a subtree", nodes: first.PreOrder(), want: []string{"Stmt a = 1 + b;", "Expr 1 + b", "Term 1", "Term b"}},
+		{
+			name:  "post-order",
+			nodes: root.PostOrder(),
+			want:  []string{"Term 1", "Term b", "Expr 1 + b", "Stmt a = 1 + b;", "Term 2", "Expr 2", "Stmt c = 2;", "Program " + navigationSource},
+		},
+		{name: "post-order of a subtree", nodes: expr.PostOrder(), want: []string{"Term 1", "Term b", "Expr 1 + b"}},
+		{
+			name:  "breadth first",
+			nodes: root.BreadthFirst(),
+			want:  []string{"Program " + navigationSource, "Stmt a = 1 + b;", "Stmt c = 2;", "Expr 1 + b", "Expr 2", "Term 1", "Term b", "Term 2"},
+		},
+		{name: "breadth first of a subtree", nodes: first.BreadthFirst(), want: []string{"Stmt a = 1 + b;", "Expr 1 + b", "Term 1", "Term b"}},
+		{name: "descendants", nodes: first.Descendants(), want: []string{"Expr 1 + b", "Term 1", "Term b"}},
+		{name: "descendants of a leaf", nodes: term.Descendants(), want: []string{}},
+		{name: "ancestors", nodes: term.Ancestors(), want: []string{"Expr 1 + b", "Stmt a = 1 + b;", "Program " + navigationSource}},
+		{name: "ancestors of the root", nodes: root.Ancestors(), want: []string{}},
+		{name: "child nodes", nodes: root.ChildNodes(), want: []string{"Stmt a = 1 + b;", "Stmt c = 2;"}},
+		{name: "child nodes of a leaf", nodes: term.ChildNodes(), want: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ruleNames(p, slices.Collect(test.nodes)...); !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			// breaking the loop stops the iteration, which would panic if it
+			// went on yielding nodes
+			for count := range len(test.want) {
+				if got := ruleNames(p, firstNodes(test.nodes, count)...); !slices.Equal(got, test.want[:count]) {
+					t.Errorf("got %q breaking after %d nodes, want %q", got, count, test.want[:count])
+				}
+			}
+		})
+	}
+}
+
+func TestTraverse(t *testing.T) {
+	p := newParser(t, streamGrammar, navigationSource)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	events := func(node *parser.ASTNode, count int) []string {
+		got := make([]string, 0)
+		for event, n := range node.Traverse() {
+			if len(got) == count {
+				break
+			}
+			prefix := "+"
+			if event == parser.EXIT_NODE {
+				prefix = "-"
+			}
+			got = append(got, prefix+ruleNames(p, n)[0])
+		}
+		return got
+	}
+	want := []string{"+Expr 1 + b", "+Term 1", "-Term 1", "+Term b", "-Term b", "-Expr 1 + b"}
+	expr := root.FirstChild().FirstChild()
+	if got := events(expr, -1); !slices.Equal(got, want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+	for count := range len(want) {
+		if got := events(expr, count); !slices.Equal(got, want[:count]) {
+			t.Errorf("got events %q breaking after %d, want %q", got, count, want[:count])
+		}
+	}
+}
+
+func TestDeepTraversals(t *testing.T) {
+	const depth = 200000
+	root := parser.NewASTNode(0, 0, depth)
+	node := root
+	for i := 1; i < depth; i++ {
+		child := parser.NewASTNode(0, i, depth)
+		node.SetFirstChild(child)
+		node = child
+	}
+	leaf := node
+	counts := map[string]int{}
+	for range root.PreOrder() {
+		counts["pre-order"]++
+	}
+	for range root.PostOrder() {
+		counts["post-order"]++
+	}
+	for range root.BreadthFirst() {
+		counts["breadth first"]++
+	}
+	for range leaf.Ancestors() {
+		counts["ancestors"]++
+	}
+	for name, count := range counts {
+		want := depth
+		if name == "ancestors" {
+			want = depth - 1
+		}
+		if count != want {
+			t.Errorf("%s: got %d nodes, want %d", name, count, want)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// Query is a compiled XPath-like query over the nodes of an AST. It does not
+// depend on a syntax, so it can be compiled once and used with any tree.
+//
+// A query is a union of paths separated by '|'. A path is a sequence of steps
+// separated by '/', selecting the children of the previous step, or by '//',
+// selecting its descendants. A path starting with '/' or '//' starts at the root
+// of the tree. A step is a rule name, compared ignoring case, '*' for any rule,
+// '.' for the node itself or '..' for its parent, followed by predicates:
+//
+//	[2]                 second node selected from the same context node
+//	[last()]            last node, [last()-1] is the one before the last
+//	[text()='include']  nodes with the text, also != to exclude it
+//	[Expression/Call]   nodes where the relative path selects some node
+type Query struct {
+	source string
+	paths  []*path
+}
+
+type axis int
+
+const (
+	childAxis axis = iota
+	descendantAxis
+	selfAxis
+	parentAxis
+)
+
+type path struct {
+	absolute bool
+	steps    []*step
+}
+
+type step struct {
+	axis       axis
+	name       string
+	predicates []predicate
+}
+
+type predicate interface {
+	filter(e *evaluator, nodes []*parser.ASTNode) []*parser.ASTNode
+}
+
+type positionPredicate struct {
+	position int
+	fromLast bool
+}
+
+type textPredicate struct {
+	text   string
+	negate bool
+}
+
+type pathPredicate struct {
+	path *path
+}
+
+// Compile parses the query.
+func Compile(query string) (*Query, error) {
+	c := &compiler{source: query}
+	paths, err := c.union()
+	if err != nil {
+		return nil, err
+	}
+	return &Query{source: query, paths: paths}, nil
+}
+
+// MustCompile is like Compile but panics if the query is invalid.
+func MustCompile(query string) *Query {
+	q, err := Compile(query)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.source
+}
+
+// Select returns the nodes selected by the query from the context node, in the
+// order of the tree and without duplicates. The parser gives the names of the
+// rules and the text of the nodes.
+func (q *Query) Select(p *parser.Parser, node *parser.ASTNode) []*parser.ASTNode {
+	if node == nil {
+		return []*parser.ASTNode{}
+	}
+	e := &evaluator{parser: p, root: node}
+	for e.root.Parent() != nil {
+		e.root = e.root.Parent()
+	}
+	selected := make(map[*parser.ASTNode]struct{})
+	for _, path := range q.paths {
+		for _, n := range e.evalPath(path, node) {
+			selected[n] = struct{}{}
+		}
+	}
+	return e.inTreeOrder(selected)
+}
+
+// First returns the first node selected by the query, or nil when no node is selected.
+func (q *Query) First(p *parser.Parser, node *parser.ASTNode) *parser.ASTNode {
+	nodes := q.Select(p, node)
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+// evaluator evaluates the paths of a query. A nil node stands for the document,
+// the parent of the root of the tree.
+type evaluator struct {
+	parser *parser.Parser
+	root   *parser.ASTNode
+}
+
+func (e *evaluator) evalPath(path *path, node *parser.ASTNode) []*parser.ASTNode {
+	context := []*parser.ASTNode{node}
+	if path.absolute {
+		context = []*parser.ASTNode{nil}
+	}
+	for _, step := range path.steps {
+		seen := make(map[*parser.ASTNode]struct{})
+		next := make([]*parser.ASTNode, 0)
+		for _, contextNode := range context {
+			for _, n := range e.evalStep(step, contextNode) {
+				if _, found := seen[n]; !found {
+					seen[n] = struct{}{}
+					next = append(next, n)
+				}
+			}
+		}
+		context = next
+	}
+	selected := make([]*parser.ASTNode, 0, len(context))
+	for _, n := range context {
+		if n != nil {
+			selected = append(selected, n)
+		}
+	}
+	return selected
+}
+
+func (e *evaluator) evalStep(step *step, node *parser.ASTNode) []*parser.ASTNode {
+	switch step.axis {
+	case selfAxis:
+		return e.applyPredicates(step, []*parser.ASTNode{node})
+	case parentAxis:
+		if node == nil {
+			return []*parser.ASTNode{}
+		}
+		return e.applyPredicates(step, []*parser.ASTNode{node.Parent()})
+	case descendantAxis:
+		selected := make([]*parser.ASTNode, 0)
+		for _, n := range e.selfAndDescendants(node) {
+			selected = append(selected, e.applyPredicates(step, e.children(n, step.name))...)
+		}
+		return selected
+	default:
+		return e.applyPredicates(step, e.children(node, step.name))
+	}
+}
+
+func (e *evaluator) applyPredicates(step *step, nodes []*parser.ASTNode) []*parser.ASTNode {
+	for _, predicate := range step.predicates {
+		nodes = predicate.filter(e, nodes)
+	}
+	return nodes
+}
+
+func (e *evaluator) children(node *parser.ASTNode, name string) []*parser.ASTNode {
+	children := make([]*parser.ASTNode, 0)
+	if node == nil {
+		if e.matches(e.root, name) {
+			children = append(children, e.root)
+		}
+		return children
+	}
+	for child := range node.ChildNodes() {
+		if e.matches(child, name) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+func (e *evaluator) selfAndDescendants(node *parser.ASTNode) []*parser.ASTNode {
+	nodes := []*parser.ASTNode{node}
+	if node == nil {
+		node = e.root
+		nodes = append(nodes, node)
+	}
+	for n := range node.Descendants() {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func (e *evaluator) matches(node *parser.ASTNode, name string) bool {
+	return name == "*" || strings.EqualFold(e.parser.Syntax().RuleName(node.RuleType()), name)
+}
+
+func (e *evaluator) inTreeOrder(selected map[*parser.ASTNode]struct{}) []*parser.ASTNode {
+	nodes := make([]*parser.ASTNode, 0, len(selected))
+	if _, found := selected[e.root]; found {
+		nodes = append(nodes, e.root)
+	}
+	for n := range e.root.Descendants() {
+		if len(nodes) == len(selected) {
+			break
+		}
+		if _, found := selected[n]; found {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (p *positionPredicate) filter(e *evaluator, nodes []*parser.ASTNode) []*parser.ASTNode {
+	index := p.position - 1
+	if p.fromLast {
+		index = len(nodes) - 1 - p.position
+	}
+	if index < 0 || index >= len(nodes) {
+		return []*parser.ASTNode{}
+	}
+	return []*parser.ASTNode{nodes[index]}
+}
+
+func (p *textPredicate) filter(e *evaluator, nodes []*parser.ASTNode) []*parser.ASTNode {
+	selected := make([]*parser.ASTNode, 0, len(nodes))
+	for _, n := range nodes {
+		if n != nil && (e.parser.NodeText(n) == p.text) != p.negate {
+			selected = append(selected, n)
+		}
+	}
+	return selected
+}
+
+func (p *pathPredicate) filter(e *evaluator, nodes []*parser.ASTNode) []*parser.ASTNode {
+	selected := make([]*parser.ASTNode, 0, len(nodes))
+	for _, n := range nodes {
+		if len(e.evalPath(p.path, n)) > 0 {
+			selected = append(selected, n)
+		}
+	}
+	return selected
+}
+
+type compiler struct {
+	source string
+	index  int
+}
+
+func (c *compiler) union() ([]*path, error) {
+	paths := make([]*path, 0)
+	for {
+		path, err := c.path()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		c.skipSpaces()
+		if c.index >= len(c.source) {
+			return paths, nil
+		}
+		if !c.accept("|") {
+			return nil, c.error("expected '|'")
+		}
+	}
+}
+
+func (c *compiler) path() (*path, error) {
+	c.skipSpaces()
+	p := &path{steps: make([]*step, 0)}
+	axis := childAxis
+	if c.accept("//") {
+		p.absolute = true
+		axis = descendantAxis
+	} else if c.accept("/") {
+		p.absolute = true
+	}
+	for {
+		step, err := c.step(axis)
+		if err != nil {
+			return nil, err
+		}
+		p.steps = append(p.steps, step)
+		if c.accept("//") {
+			axis = descendantAxis
+		} else if c.accept("/") {
+			axis = childAxis
+		} else {
+			return p, nil
+		}
+	}
+}
+
+func (c *compiler) step(axis axis) (*step, error) {
+	c.skipSpaces()
+	s := &step{axis: axis, predicates: make([]predicate, 0)}
+	switch {
+	case c.accept(".."):
+		s.axis = parentAxis
+	case c.accept("."):
+		s.axis = selfAxis
+	case c.accept("*"):
+		s.name = "*"
+	default:
+		s.name = c.name()
+		if s.name == "" {
+			return nil, c.error("expected rule name")
+		}
+	}
+	if (s.axis == parentAxis || s.axis == selfAxis) && axis == descendantAxis {
+		return nil, c.error("'.' and '..' can not follow '//'")
+	}
+	for c.accept("[") {
+		predicate, err := c.predicate()
+		if err != nil {
+			return nil, err
+		}
+		if !c.accept("]") {
+			return nil, c.error("expected ']'")
+		}
+		s.predicates = append(s.predicates, predicate)
+	}
+	return s, nil
+}
+
+func (c *compiler) predicate() (predicate, error) {
+	c.skipSpaces()
+	switch {
+	case c.accept("last()"):
+		p := &positionPredicate{fromLast: true}
+		if c.accept("-") {
+			p.position = c.number()
+			if p.position < 0 {
+				return nil, c.error("expected number")
+			}
+		}
+		return p, nil
+	case c.accept("text()"):
+		p := &textPredicate{}
+		if c.accept("!=") {
+			p.negate = true
+		} else if !c.accept("=") {
+			return nil, c.error("expected '=' or '!='")
+		}
+		text, err := c.literal()
+		if err != nil {
+			return nil, err
+		}
+		p.text = text
+		return p, nil
+	}
+	if position := c.number(); position >= 0 {
+		if position == 0 {
+			return nil, c.error("positions start at 1")
+		}
+		return &positionPredicate{position: position}, nil
+	}
+	path, err := c.path()
+	if err != nil {
+		return nil, err
+	}
+	if path.absolute {
+		return nil, c.error("path predicates must be relative")
+	}
+	return &pathPredicate{path: path}, nil
+}
+
+func (c *compiler) name() string {
+	start := c.index
+	for c.index < len(c.source) {
+		ch := c.source[c.index]
+		if ch != '_' && ch != '#' && !isLetter(ch) && !isDigit(ch) {
+			break
+		}
+		c.index++
+	}
+	return c.source[start:c.index]
+}
+
+// number reads a positive integer, returning -1 when there is no number.
+func (c *compiler) number() int {
+	c.skipSpaces()
+	start := c.index
+	for c.index < len(c.source) && isDigit(c.source[c.index]) {
+		c.index++
+	}
+	if start == c.index {
+		return -1
+	}
+	value, err := strconv.Atoi(c.source[start:c.index])
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+func (c *compiler) literal() (string, error) {
+	c.skipSpaces()
+	if c.index >= len(c.source) || (c.source[c.index] != '\'' && c.source[c.index] != '"') {
+		return "", c.error("expected quoted text")
+	}
+	quote := c.source[c.index]
+	end := strings.IndexByte(c.source[c.index+1:], quote)
+	if end < 0 {
+		return "", c.error("unterminated text")
+	}
+	text := c.source[c.index+1 : c.index+1+end]
+	c.index += end + 2
+	return text, nil
+}
+
+func (c *compiler) accept(text string) bool {
+	c.skipSpaces()
+	if strings.HasPrefix(c.source[c.index:], text) {
+		c.index += len(text)
+		return true
+	}
+	return false
+}
+
+func (c *compiler) skipSpaces() {
+	for c.index < len(c.source) && (c.source[c.index] == ' ' || c.source[c.index] == '\t') {
+		c.index++
+	}
+}
+
+func (c *compiler) error(message string) error {
+	return fmt.Errorf("invalid query '%s': %s at position %d", c.source, message, c.index+1)
+}
+
+func isLetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,177 @@
+package query_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/runtime/query"
+)
+
+const callsGrammar = `grammar Calls;
+
+Program : Stmt* EOI;
+
+Stmt : Import | Assign | Block;
+
+Import : '<' Name '>';
+
+Assign : Name '=' Expr ';';
+
+Block : '{' Stmt* '}';
+
+Expr : Call | Name | Number;
+
+Call : Name '(' Expr? ')';
+
+Name : Ident;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+const callsSource = `<io>
+a = f(b);
+{ c = include(d); <os> }
+e = include(1);`
+
+// parse parses the source with the grammar of calls.
+func parse(t testing.TB, source string) (*parser.Parser, *parser.ASTNode) {
+	t.Helper()
+	g, err := grammar.FromString(callsGrammar)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	p := parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	return p, root
+}
+
+// nodesString writes the rule names of the nodes with their texts.
+func nodesString(p *parser.Parser, nodes []*parser.ASTNode) string {
+	texts := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		texts = append(texts, p.Syntax().RuleName(n.RuleType())+"("+p.NodeText(n)+")")
+	}
+	return strings.Join(texts, ", ")
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "//Import", want: "Import(<io>), Import(<os>)"},
+		{query: "/Program/Stmt/Import", want: "Import(<io>)"},
+		{query: "Stmt/Assign/Name", want: "Name(a), Name(e)"},
+		{query: "//stmt/ASSIGN/name", want: "Name(a), Name(c), Name(e)"},
+		{query: "//Block//Name", want: "Name(c), Name(include), Name(d), Name(os)"},
+		{query: "//Call/*", want: "Name(f), Expr(b), Name(include), Expr(d), Name(include), Expr(1)"},
+		{query: "//Call/..", want: "Expr(f(b)), Expr(include(d)), Expr(include(1))"},
+		{query: "//Import/.", want: "Import(<io>), Import(<os>)"},
+		{query: "//Name[text()='include']", want: "Name(include), Name(include)"},
+		{query: "//Call[Name[text()='include']]", want: "Call(include(d)), Call(include(1))"},
+		{query: "//Call[Name[text()!='include']]", want: "Call(f(b))"},
+		{query: "//Call[Expr/Name]", want: "Call(f(b)), Call(include(d))"},
+		// the positions are among the nodes selected from the same context node
+		{query: "//Stmt[2]", want: "Stmt(a = f(b);), Stmt(<os>)"},
+		{query: "Stmt[last()]", want: "Stmt(e = include(1);)"},
+		{query: "Stmt[last()-1]", want: "Stmt({ c = include(d); <os> })"},
+		{query: "Stmt[last()-4]", want: ""},
+		{query: "Stmt[9]", want: ""},
+		{query: "//Assign[2]", want: ""},
+		{query: "//Stmt[Assign][2]", want: "Stmt(e = include(1);)"},
+		// the union selects each node once, in the order of the tree
+		{query: "//Name[text()='include'] | //Import", want: "Import(<io>), Name(include), Import(<os>), Name(include)"},
+		{query: "//Call/.. | //Expr[Call]", want: "Expr(f(b)), Expr(include(d)), Expr(include(1))"},
+		{query: "//Missing", want: ""},
+		{query: "..", want: ""},
+		{query: ".", want: "Program(" + callsSource + ")"},
+	}
+	p, root := parse(t, callsSource)
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := query.Compile(test.query)
+			if err != nil {
+				t.Fatalf("compile failed: %v", err)
+			}
+			if got := nodesString(p, q.Select(p, root)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectFromNode(t *testing.T) {
+	p, root := parse(t, callsSource)
+	block := query.MustCompile("//Block").First(p, root)
+	if block == nil {
+		t.Fatal("got no block")
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "Stmt/*", want: "Assign(c = include(d);), Import(<os>)"},
+		{query: "..", want: "Stmt({ c = include(d); <os> })"},
+		{query: "../../Stmt[1]/Import", want: "Import(<io>)"},
+		{query: "//Import", want: "Import(<io>), Import(<os>)"},
+		{query: ".//Import", want: "Import(<os>)"},
+	}
+	for _, test := range tests {
+		if got := nodesString(p, query.MustCompile(test.query).Select(p, block)); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.query, got, test.want)
+		}
+	}
+	if got := query.MustCompile("//Missing").First(p, root); got != nil {
+		t.Errorf("got first %s, want nil", nodesString(p, []*parser.ASTNode{got}))
+	}
+	if got := query.MustCompile("//Import").Select(p, nil); len(got) != 0 {
+		t.Errorf("got %s from a nil node, want nothing", nodesString(p, got))
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: "expected rule name at position 1"},
+		{query: "//", want: "expected rule name at position 3"},
+		{query: "Stmt Assign", want: "expected '|' at position 6"},
+		{query: "Stmt[", want: "expected rule name"},
+		{query: "Stmt[1", want: "expected ']'"},
+		{query: "Stmt[0]", want: "positions start at 1"},
+		{query: "Stmt[last()-]", want: "expected number"},
+		{query: "Name[text()~'a']", want: "expected '=' or '!='"},
+		{query: "Name[text()=a]", want: "expected quoted text"},
+		{query: "Name[text()='a]", want: "unterminated text"},
+		{query: "Stmt[/Assign]", want: "path predicates must be relative"},
+		{query: "Stmt//..", want: "'.' and '..' can not follow '//'"},
+	}
+	for _, test := range tests {
+		_, err := query.Compile(test.query)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: got error %v, want %q", test.query, err, test.want)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("MustCompile did not panic for an invalid query")
+		}
+	}()
+	query.MustCompile("Stmt[")
+}
@@ -0,0 +1,175 @@
+package render
+
+import (
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/util"
+)
+
+// Options controls how a parse tree is drawn.
+type Options struct {
+	// MaxDepth is the number of levels drawn below the root. The children of the
+	// nodes in the last level are replaced by an ellipsis. Zero draws all levels.
+	MaxDepth int
+	// Collapse draws a chain of nodes with a single child as one node.
+	Collapse bool
+	// LeafText adds the text of the leaves to their labels.
+	LeafText bool
+	// HighlightErrors fills the error nodes created by the error recovery.
+	HighlightErrors bool
+}
+
+// maxTextLen is the length of the leaf texts in the labels.
+const maxTextLen = 30
+
+// box is a node of the drawing, that can stand for a chain of collapsed nodes.
+type box struct {
+	id       int
+	label    string
+	error    bool
+	more     bool
+	children []*box
+}
+
+type boxBuilder struct {
+	parser  *parser.Parser
+	options Options
+	nextId  int
+}
+
+func (b *boxBuilder) build(node *parser.ASTNode, depth int) *box {
+	names := []string{b.parser.Syntax().RuleName(node.RuleType())}
+	isError := node.IsError()
+	if b.options.Collapse {
+		for node.FirstChild() != nil && node.FirstChild().Sibling() == nil {
+			node = node.FirstChild()
+			names = append(names, b.parser.Syntax().RuleName(node.RuleType()))
+			isError = isError || node.IsError()
+		}
+	}
+	bx := &box{id: b.nextId, label: strings.Join(names, " / "), error: isError}
+	b.nextId++
+	if node.FirstChild() == nil {
+		if b.options.LeafText {
+			bx.label += "\n" + shortText(b.parser.NodeText(node))
+		}
+		return bx
+	}
+	if b.options.MaxDepth > 0 && depth >= b.options.MaxDepth {
+		bx.more = true
+		return bx
+	}
+	for child := range node.ChildNodes() {
+		bx.children = append(bx.children, b.build(child, depth+1))
+	}
+	return bx
+}
+
+func shortText(text string) string {
+	runes := []rune(text)
+	if len(runes) > maxTextLen {
+		text = string(runes[:maxTextLen-3]) + "..."
+	}
+	return "'" + text + "'"
+}
+
+// ToDot writes the tree as a Graphviz digraph.
+func ToDot(name string, p *parser.Parser, root *parser.ASTNode, options Options, writer util.TextWriter) {
+	builder := &boxBuilder{parser: p, options: options}
+	bx := builder.build(root, 0)
+	writer.WriteString("digraph \"").WriteString(dotLabel(name)).WriteString("\" {").NewLine()
+	writer.Indent(3)
+	writer.WriteString("fontname=\"Helvetica,Arial,sans-serif\"").NewLine()
+	writer.WriteString("node [fontname=\"Helvetica,Arial,sans-serif\" shape=box]").NewLine()
+	writer.WriteString("edge [fontname=\"Helvetica,Arial,sans-serif\"]").NewLine()
+	boxToDot(bx, options, writer)
+	writer.Indent(-3).WriteRune('}').NewLine()
+}
+
+func boxToDot(bx *box, options Options, writer util.TextWriter) {
+	writer.WriteF("n%d [label=\"%s\"", bx.id, dotLabel(bx.label))
+	if bx.error && options.HighlightErrors {
+		writer.WriteString(" style=filled fillcolor=\"#f4a0a0\" color=red")
+	}
+	writer.WriteRune(']').NewLine()
+	if bx.more {
+		writer.WriteF("n%d_more [label=\"...\" shape=plaintext]", bx.id).NewLine()
+		writer.WriteF("n%d -> n%d_more", bx.id, bx.id).NewLine()
+	}
+	for _, child := range bx.children {
+		writer.WriteF("n%d -> n%d", bx.id, child.id).NewLine()
+		boxToDot(child, options, writer)
+	}
+}
+
+// dotLabel escapes the label for a quoted string of DOT. The line breaks are
+// kept and the other white space is written as spaces, like in Mermaid labels.
+func dotLabel(label string) string {
+	str := &strings.Builder{}
+	for _, c := range label {
+		switch c {
+		case '"':
+			str.WriteString("\\\"")
+		case '\\':
+			str.WriteString("\\\\")
+		case '\n':
+			str.WriteString("\\n")
+		case '\r', '\t':
+			str.WriteRune(' ')
+		default:
+			str.WriteRune(c)
+		}
+	}
+	return str.String()
+}
+
+// ToMermaid writes the tree as a Mermaid flowchart.
+func ToMermaid(p *parser.Parser, root *parser.ASTNode, options Options, writer util.TextWriter) {
+	builder := &boxBuilder{parser: p, options: options}
+	bx := builder.build(root, 0)
+	writer.WriteString("graph TD").NewLine()
+	writer.Indent(3)
+	if options.HighlightErrors {
+		writer.WriteString("classDef error fill:#f4a0a0,stroke:#d00").NewLine()
+	}
+	boxToMermaid(bx, options, writer)
+	writer.Indent(-3)
+}
+
+func boxToMermaid(bx *box, options Options, writer util.TextWriter) {
+	writer.WriteF("n%d[\"%s\"]", bx.id, mermaidLabel(bx.label)).NewLine()
+	if bx.error && options.HighlightErrors {
+		writer.WriteF("class n%d error", bx.id).NewLine()
+	}
+	if bx.more {
+		writer.WriteF("n%d --> n%d_more[...]", bx.id, bx.id).NewLine()
+	}
+	for _, child := range bx.children {
+		writer.WriteF("n%d --> n%d", bx.id, child.id).NewLine()
+		boxToMermaid(child, options, writer)
+	}
+}
+
+func mermaidLabel(label string) string {
+	str := &strings.Builder{}
+	for _, c := range label {
+		switch c {
+		case '"':
+			str.WriteString("#quot;")
+		case '#':
+			str.WriteString("#35;")
+		case '<':
+			str.WriteString("#lt;")
+		case '>':
+			str.WriteString("#gt;")
+		case '\n':
+			str.WriteString("<br/>")
+		case '\r', '\t':
+			str.WriteRune(' ')
+		default:
+			str.WriteRune(c)
+		}
+	}
+	return str.String()
+}
@@ -0,0 +1,181 @@
+package render_test
+
+import (
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/runtime/render"
+	"github.com/fabiouggeri/page/util"
+)
+
+const assignsGrammar = `grammar Assigns;
+
+Program : Stmt* EOI;
+
+Stmt : Ident '=' Expr ';';
+
+Expr : Term ('+' Term)*;
+
+Term : Ident | Number | String;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+String : '"' ('"')!* '"';
+
+Dollar : '$';
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// parse parses the source recovering from errors.
+func parse(t testing.TB, source string) (*parser.Parser, *parser.ASTNode) {
+	t.Helper()
+	g, err := grammar.FromString(assignsGrammar)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	p := parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+	p.SetRecovery(true)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	return p, root
+}
+
+// renderSource has a tab, quotes and a backslash in the leaves, a text longer
+// than the labels and an error node.
+const renderSource = "a = 1 + \"x\ty\\\";\nb = 2 $ \"a long text with more than thirty runes\";"
+
+func TestDot(t *testing.T) {
+	tests := []struct {
+		name    string
+		options render.Options
+		want    string
+	}{
+		{
+			name:    "leaves and errors",
+			options: render.Options{LeafText: true, HighlightErrors: true},
+			want: `digraph "Assigns \"tree\"" {
+   fontname="Helvetica,Arial,sans-serif"
+   node [fontname="Helvetica,Arial,sans-serif" shape=box]
+   edge [fontname="Helvetica,Arial,sans-serif"]
+   n0 [label="Program"]
+   n0 -> n1
+   n1 [label="Stmt"]
+   n1 -> n2
+   n2 [label="Expr"]
+   n2 -> n3
+   n3 [label="Term\n'1'"]
+   n2 -> n4
+   n4 [label="Term\n'\"x y\\\"'"]
+   n0 -> n5
+   n5 [label="Stmt"]
+   n5 -> n6
+   n6 [label="Expr"]
+   n6 -> n7
+   n7 [label="Term\n'2'"]
+   n6 -> n8
+   n8 [label="Error\n'$'" style=filled fillcolor="#f4a0a0" color=red]
+   n6 -> n9
+   n9 [label="Term\n'\"a long text with more than...'"]
+}
+`,
+		},
+		{
+			name:    "collapsed",
+			options: render.Options{Collapse: true},
+			want: `digraph "Assigns \"tree\"" {
+   fontname="Helvetica,Arial,sans-serif"
+   node [fontname="Helvetica,Arial,sans-serif" shape=box]
+   edge [fontname="Helvetica,Arial,sans-serif"]
+   n0 [label="Program"]
+   n0 -> n1
+   n1 [label="Stmt / Expr"]
+   n1 -> n2
+   n2 [label="Term"]
+   n1 -> n3
+   n3 [label="Term"]
+   n0 -> n4
+   n4 [label="Stmt / Expr"]
+   n4 -> n5
+   n5 [label="Term"]
+   n4 -> n6
+   n6 [label="Error"]
+   n4 -> n7
+   n7 [label="Term"]
+}
+`,
+		},
+		{
+			name:    "max depth",
+			options: render.Options{MaxDepth: 2, HighlightErrors: true},
+			want: `digraph "Assigns \"tree\"" {
+   fontname="Helvetica,Arial,sans-serif"
+   node [fontname="Helvetica,Arial,sans-serif" shape=box]
+   edge [fontname="Helvetica,Arial,sans-serif"]
+   n0 [label="Program"]
+   n0 -> n1
+   n1 [label="Stmt"]
+   n1 -> n2
+   n2 [label="Expr"]
+   n2_more [label="..." shape=plaintext]
+   n2 -> n2_more
+   n0 -> n3
+   n3 [label="Stmt"]
+   n3 -> n4
+   n4 [label="Expr"]
+   n4_more [label="..." shape=plaintext]
+   n4 -> n4_more
+}
+`,
+		},
+	}
+	p, root := parse(t, renderSource)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := util.NewStringTextWriter()
+			render.ToDot("Assigns \"tree\"", p, root, test.options, writer)
+			if got := writer.String(); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	want := `graph TD
+   classDef error fill:#f4a0a0,stroke:#d00
+   n0["Program"]
+   n0 --> n1
+   n1["Stmt / Expr"]
+   n1 --> n2
+   n2["Term<br/>'1'"]
+   n1 --> n3
+   n3["Term<br/>'#quot;x y\#quot;'"]
+   n0 --> n4
+   n4["Stmt / Expr"]
+   n4 --> n5
+   n5["Term<br/>'2'"]
+   n4 --> n6
+   n6["Error<br/>'$'"]
+   class n6 error
+   n4 --> n7
+   n7["Term<br/>'#quot;a long text with more than...'"]
+`
+	p, root := parse(t, renderSource)
+	writer := util.NewStringTextWriter()
+	render.ToMermaid(p, root, render.Options{Collapse: true, LeafText: true, HighlightErrors: true}, writer)
+	if got := writer.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+package rewrite
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// Rewriter changes a parsed tree and regenerates the source text from it. The
+// text of the nodes left untouched, and of the tokens between them, is taken
+// from the input, so spaces, comments and formatting are kept. The nodes put in
+// the tree by the rewriter, created by NewNode or moved from another place,
+// keep the text they had when they were inserted and can not be changed anymore.
+type Rewriter struct {
+	input   input.Input
+	tokens  []*lexer.Token
+	first   int
+	root    *parser.ASTNode
+	texts   map[*parser.ASTNode]string
+	anchors map[*parser.ASTNode]span
+	dirty   map[*parser.ASTNode]bool
+	deleted []span
+}
+
+// span is a range of tokens. An empty span, with end before start, marks the
+// place before the token at start.
+type span struct {
+	start int
+	end   int
+}
+
+func NewRewriter(p *parser.Parser, root *parser.ASTNode) *Rewriter {
+	return &Rewriter{
+		input:   p.Lexer().Input(),
+		tokens:  p.Lexer().Tokens(),
+		first:   p.Lexer().Released(),
+		root:    root,
+		texts:   make(map[*parser.ASTNode]string),
+		anchors: make(map[*parser.ASTNode]span),
+		dirty:   make(map[*parser.ASTNode]bool),
+		deleted: make([]span, 0),
+	}
+}
+
+// Root returns the root of the tree, that changes when the root is replaced or wrapped.
+func (r *Rewriter) Root() *parser.ASTNode {
+	return r.root
+}
+
+// NewNode creates a node with the text, not yet in the tree.
+func (r *Rewriter) NewNode(ruleType int, text string) *parser.ASTNode {
+	node := parser.NewASTNode(ruleType, 0, -1)
+	r.texts[node] = text
+	return node
+}
+
+// Replace puts the node in the place of the old one, keeping the trivia of the
+// old node in a concrete syntax tree. The old node is removed from the tree with
+// its text as it is now, so it can be inserted again elsewhere.
+func (r *Rewriter) Replace(old *parser.ASTNode, node *parser.ASTNode) error {
+	if err := r.checkChangeable(old); err != nil {
+		return err
+	}
+	if err := r.checkInsertable(node); err != nil {
+		return err
+	}
+	r.freeze(node)
+	if anchor, found := r.anchors[old]; found {
+		r.anchors[node] = anchor
+	} else {
+		r.anchors[node] = span{start: old.StartToken(), end: old.EndToken()}
+	}
+	r.texts[old] = r.NodeText(old)
+	r.markDirty(old.Parent())
+	if old == r.root {
+		r.root = node
+	} else {
+		old.ReplaceWith(node)
+	}
+	return nil
+}
+
+// InsertChild inserts the child at the position among the children of the
+// parent. The text of the child is placed before the text of the child that is
+// now at that position, after the last child when appending, or before the last
+// token of the parent when it has no children.
+func (r *Rewriter) InsertChild(parent *parser.ASTNode, index int, child *parser.ASTNode) error {
+	if err := r.checkChangeable(parent); err != nil {
+		return err
+	}
+	if err := r.checkInsertable(child); err != nil {
+		return err
+	}
+	children := parent.Children()
+	if index < 0 || index > len(children) {
+		return errors.New("child index out of range")
+	}
+	r.freeze(child)
+	switch {
+	case index < len(children):
+		start := r.span(children[index]).start
+		r.anchors[child] = span{start: start, end: start - 1}
+	case len(children) > 0:
+		end := r.span(children[len(children)-1]).end
+		r.anchors[child] = span{start: end + 1, end: end}
+	default:
+		parentSpan := r.span(parent)
+		start := max(parentSpan.end, parentSpan.start)
+		r.anchors[child] = span{start: start, end: start - 1}
+	}
+	r.markDirty(parent)
+	parent.InsertChild(index, child)
+	return nil
+}
+
+// Delete removes the node, its descendants and their text, including the trivia
+// of a concrete syntax tree. The node keeps its text as it is now, so it can be
+// inserted again elsewhere.
+func (r *Rewriter) Delete(node *parser.ASTNode) error {
+	if err := r.checkChangeable(node); err != nil {
+		return err
+	}
+	if node == r.root {
+		return errors.New("the root can not be deleted")
+	}
+	r.texts[node] = r.NodeText(node)
+	r.deleted = append(r.deleted, r.span(node))
+	r.markDirty(node.Parent())
+	node.Detach()
+	return nil
+}
+
+// Wrap puts a new node of the rule type in the place of the node, which becomes
+// its only child. The text is not changed.
+func (r *Rewriter) Wrap(node *parser.ASTNode, ruleType int) (*parser.ASTNode, error) {
+	if err := r.checkChangeable(node); err != nil {
+		return nil, err
+	}
+	wrapper := node.Wrap(ruleType)
+	r.anchors[wrapper] = r.span(node)
+	r.markDirty(wrapper)
+	if node == r.root {
+		r.root = wrapper
+	}
+	return wrapper, nil
+}
+
+// Text returns the whole source text with the changes made to the tree.
+func (r *Rewriter) Text() string {
+	str := &strings.Builder{}
+	rootSpan := r.span(r.root)
+	r.writeTokens(str, 0, rootSpan.start-1)
+	r.writeNode(str, r.root)
+	r.writeTokens(str, max(rootSpan.start, rootSpan.end+1), r.first+len(r.tokens)-1)
+	return str.String()
+}
+
+// NodeText returns the text of the node with the changes made to its subtree.
+func (r *Rewriter) NodeText(node *parser.ASTNode) string {
+	str := &strings.Builder{}
+	r.writeNode(str, node)
+	return str.String()
+}
+
+func (r *Rewriter) writeNode(str *strings.Builder, node *parser.ASTNode) {
+	if text, found := r.texts[node]; found {
+		str.WriteString(text)
+		return
+	}
+	nodeSpan := r.span(node)
+	if !r.dirty[node] {
+		r.writeTokens(str, nodeSpan.start, nodeSpan.end)
+		return
+	}
+	cursor := nodeSpan.start
+	for child := range node.ChildNodes() {
+		childSpan := r.span(child)
+		r.writeTokens(str, cursor, childSpan.start-1)
+		r.writeNode(str, child)
+		cursor = max(cursor, childSpan.end+1)
+	}
+	r.writeTokens(str, cursor, nodeSpan.end)
+}
+
+// writeTokens writes the text of the tokens in the range that were not deleted.
+// The tokens released by the lexer before the rewriter was created are skipped.
+func (r *Rewriter) writeTokens(str *strings.Builder, start int, end int) {
+	start = max(start, r.first)
+	end = min(end, r.first+len(r.tokens)-1)
+	for start <= end {
+		if deletedEnd := r.deletedEnd(start); deletedEnd >= start {
+			start = deletedEnd + 1
+			continue
+		}
+		last := start
+		for last < end && r.deletedEnd(last+1) < last+1 {
+			last++
+		}
+		startToken, lastToken := r.tokens[start-r.first], r.tokens[last-r.first]
+		str.WriteString(r.input.GetText(startToken.Index(), lastToken.Index()+lastToken.Len()))
+		start = last + 1
+	}
+}
+
+// deletedEnd returns the end of the deleted range that contains the token index,
+// or -1 when the token was not deleted.
+func (r *Rewriter) deletedEnd(index int) int {
+	end := -1
+	for _, deleted := range r.deleted {
+		if index >= deleted.start && index <= deleted.end {
+			end = max(end, deleted.end)
+		}
+	}
+	return end
+}
+
+func (r *Rewriter) span(node *parser.ASTNode) span {
+	if anchor, found := r.anchors[node]; found {
+		return anchor
+	}
+	return span{start: node.FullStartToken(), end: node.FullEndToken()}
+}
+
+// freeze keeps the text of a node being inserted, which may come from its tokens.
+func (r *Rewriter) freeze(node *parser.ASTNode) {
+	if _, found := r.texts[node]; !found {
+		r.texts[node] = r.NodeText(node)
+	}
+}
+
+func (r *Rewriter) markDirty(node *parser.ASTNode) {
+	for ; node != nil; node = node.Parent() {
+		r.dirty[node] = true
+	}
+}
+
+// checkChangeable checks that the node is in the tree and was not inserted by the rewriter.
+func (r *Rewriter) checkChangeable(node *parser.ASTNode) error {
+	for n := node; n != nil; n = n.Parent() {
+		if _, found := r.texts[n]; found {
+			return errors.New("nodes inserted by the rewriter can not be changed")
+		}
+		if n == r.root {
+			return nil
+		}
+	}
+	return errors.New("node is not in the tree")
+}
+
+func (r *Rewriter) checkInsertable(node *parser.ASTNode) error {
+	if node.Parent() != nil || node == r.root {
+		return errors.New("node is already in the tree")
+	}
+	return nil
+}
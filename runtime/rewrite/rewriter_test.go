@@ -0,0 +1,162 @@
+package rewrite_test
+
+import (
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/runtime/rewrite"
+)
+
+const assignsGrammar = `grammar Assigns;
+
+Program : Stmt* EOI;
+
+Stmt : Ident '=' Expr ';';
+
+Expr : Term ('+' Term)*;
+
+Term : Ident | Number;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+
+@Ignore
+Comment : '#' ('\n')!*;
+`
+
+const assignsSource = "a = 1 + b; # one\n  c  =  2;\n"
+
+// parse parses the source with the grammar of assignments, with or without a
+// concrete syntax tree.
+func parse(t *testing.T, source string, cst bool) (*parser.Parser, *parser.ASTNode) {
+	t.Helper()
+	g, err := grammar.FromString(assignsGrammar)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	p := parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+	p.SetCST(cst)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	return p, root
+}
+
+func TestRewriteUntouched(t *testing.T) {
+	for _, cst := range []bool{false, true} {
+		p, root := parse(t, assignsSource, cst)
+		r := rewrite.NewRewriter(p, root)
+		if got := r.Text(); got != assignsSource {
+			t.Errorf("cst %v: got text %q, want %q", cst, got, assignsSource)
+		}
+		// the trivia up to the end of the line is part of a concrete syntax tree node
+		want := map[bool]string{false: "c  =  2;", true: "c  =  2;\n"}[cst]
+		if got := r.NodeText(root.FirstChild().Sibling()); got != want {
+			t.Errorf("cst %v: got node text %q, want %q", cst, got, want)
+		}
+		if errors := p.Lexer().Errors(); len(errors) > 0 {
+			t.Errorf("cst %v: got lexer errors %v", cst, errors)
+		}
+	}
+}
+
+func TestRewriteChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(r *rewrite.Rewriter, p *parser.Parser, root *parser.ASTNode) error
+		want   string
+	}{
+		{
+			name: "replace",
+			change: func(r *rewrite.Rewriter, p *parser.Parser, root *parser.ASTNode) error {
+				expr := root.FirstChild().FirstChild()
+				return r.Replace(expr, r.NewNode(expr.RuleType(), "x * 2"))
+			},
+			want: "a = x * 2; # one\n  c  =  2;\n",
+		},
+		{
+			name: "insert before",
+			change: func(r *rewrite.Rewriter, p *parser.Parser, root *parser.ASTNode) error {
+				return r.InsertChild(root, 1, r.NewNode(p.Syntax().RuleId("Stmt"), "d = 4;\n  "))
+			},
+			want: "a = 1 + b; # one\n  d = 4;\n  c  =  2;\n",
+		},
+		{
+			name: "insert last",
+			change: func(r *rewrite.Rewriter, p *parser.Parser, root *parser.ASTNode) error {
+				expr := root.FirstChild().FirstChild()
+				return r.InsertChild(expr, 2, r.NewNode(expr.FirstChild().RuleType(), " + 3"))
+			},
+			want: "a = 1 + b + 3; # one\n  c  =  2;\n",
+		},
+		{
+			name: "delete",
+			change: func(r *rewrite.Rewriter, p *parser.Parser, root *parser.ASTNode) error {
+				return r.Delete(root.FirstChild())
+			},
+			want: " # one\n  c  =  2;\n",
+		},
+		{
+			name: "move",
+			change: func(r *rewrite.Rewriter, p *parser.Parser, root *parser.ASTNode) error {
+				first := root.FirstChild()
+				if err := r.Delete(first); err != nil {
+					return err
+				}
+				return r.InsertChild(root, 1, first)
+			},
+			want: " # one\n  c  =  2;a = 1 + b;\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, root := parse(t, assignsSource, false)
+			r := rewrite.NewRewriter(p, root)
+			if err := test.change(r, p, root); err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got := r.Text(); got != test.want {
+				t.Errorf("got text %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRewriteInvalidChanges(t *testing.T) {
+	p, root := parse(t, assignsSource, false)
+	r := rewrite.NewRewriter(p, root)
+	node := r.NewNode(p.Syntax().RuleId("Stmt"), "d = 4;")
+	if err := r.InsertChild(root, 0, node); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if r.Delete(root) == nil || r.Delete(node) == nil || r.InsertChild(root, 0, root.LastChild()) == nil || r.InsertChild(root, 5, r.NewNode(0, "")) == nil {
+		t.Errorf("invalid change accepted")
+	}
+	if got, want := r.Text(), "d = 4;"+assignsSource; got != want {
+		t.Errorf("got text %q, want %q", got, want)
+	}
+}
+
+func TestRewriteReleasedTokens(t *testing.T) {
+	p, root := parse(t, assignsSource, false)
+	// the tokens of the first statement
+	p.Lexer().Release(10)
+	r := rewrite.NewRewriter(p, root.LastChild())
+	if err := r.Replace(root.LastChild().FirstChild(), r.NewNode(0, "3")); err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if got, want := r.Text(), " # one\n  c  =  3;\n"; got != want {
+		t.Errorf("got text %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+package serializer
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// WriteJSON writes the tree as a JSON object for each node, with the children in the "children" array.
+func WriteJSON(w io.Writer, p *parser.Parser, root *parser.ASTNode, options Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", options.Indent)
+	return encoder.Encode(toNode(p, root, options))
+}
+
+// ReadJSON rebuilds a tree written by WriteJSON, finding the rules by name in the syntax.
+func ReadJSON(r io.Reader, s *parser.Syntax) (*parser.ASTNode, error) {
+	n := &node{}
+	if err := json.NewDecoder(r).Decode(n); err != nil {
+		return nil, err
+	}
+	return fromNode(s, n)
+}
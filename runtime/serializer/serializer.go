@@ -0,0 +1,91 @@
+package serializer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// Options controls what is written for each node.
+type Options struct {
+	// Text writes the text of the nodes.
+	Text bool
+	// Indent is the indentation of each level of the tree. An empty indentation
+	// writes the tree in a single line.
+	Indent string
+}
+
+// node is the tree written and read by all the formats.
+type node struct {
+	XMLName  xml.Name `json:"-" xml:"node"`
+	Rule     string   `json:"rule" xml:"rule,attr"`
+	Token    bool     `json:"token,omitempty" xml:"token,attr,omitempty"`
+	Start    int      `json:"start" xml:"start,attr"`
+	End      int      `json:"end" xml:"end,attr"`
+	Row      int      `json:"row" xml:"row,attr"`
+	Col      int      `json:"col" xml:"col,attr"`
+	Text     *string  `json:"text,omitempty" xml:"text,attr,omitempty"`
+	Children []*node  `json:"children,omitempty" xml:"node"`
+}
+
+func toNode(p *parser.Parser, astNode *parser.ASTNode, options Options) *node {
+	row, col := p.Position(astNode)
+	n := &node{
+		Rule:     p.Syntax().RuleName(astNode.RuleType()),
+		Token:    astNode.IsToken(),
+		Start:    astNode.StartToken(),
+		End:      astNode.EndToken(),
+		Row:      row,
+		Col:      col,
+		Children: make([]*node, 0),
+	}
+	if options.Text {
+		text := p.NodeText(astNode)
+		n.Text = &text
+	}
+	for child := range astNode.ChildNodes() {
+		n.Children = append(n.Children, toNode(p, child, options))
+	}
+	return n
+}
+
+func fromNode(s *parser.Syntax, n *node) (*parser.ASTNode, error) {
+	ruleType, err := ruleType(s, n.Rule)
+	if err != nil {
+		return nil, err
+	}
+	var astNode *parser.ASTNode
+	if n.Token {
+		astNode = parser.NewTokenNode(ruleType, n.Start)
+	} else {
+		astNode = parser.NewASTNode(ruleType, n.Start, n.End)
+	}
+	var first, last *parser.ASTNode
+	for _, child := range n.Children {
+		astChild, err := fromNode(s, child)
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = astChild
+		} else {
+			last.SetSibling(astChild)
+		}
+		last = astChild
+	}
+	astNode.SetFirstChild(first)
+	return astNode, nil
+}
+
+func ruleType(s *parser.Syntax, ruleName string) (int, error) {
+	if strings.EqualFold(ruleName, s.RuleName(parser.ERROR_RULE)) {
+		return parser.ERROR_RULE, nil
+	}
+	ruleId := s.RuleId(ruleName)
+	if ruleId < 0 {
+		return 0, fmt.Errorf("rule '%s' not found", ruleName)
+	}
+	return ruleId, nil
+}
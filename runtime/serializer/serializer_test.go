@@ -0,0 +1,146 @@
+package serializer_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/runtime/serializer"
+)
+
+const assignsGrammar = `grammar Assigns;
+
+Program : Stmt* EOI;
+
+Stmt : Ident '=' Expr ';';
+
+Expr : Term ('+' Term)*;
+
+Term : Ident | Number;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+Dollar : '$';
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+// assignsSource has new lines and spaces in the texts of the nodes, and a '$'
+// recovered as an error node.
+const assignsSource = "a = 1 + b;\n  c = 2 $ 3;"
+
+// parse parses the source keeping the tokens in the tree and recovering from errors.
+func parse(t testing.TB, source string) (*parser.Parser, *parser.ASTNode) {
+	t.Helper()
+	g, err := grammar.FromString(assignsGrammar)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	p := parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+	p.SetCST(true)
+	p.SetRecovery(true)
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	return p, root
+}
+
+// structure writes the rules, the tokens and the kind of the nodes of the tree.
+func structure(s *parser.Syntax, node *parser.ASTNode) string {
+	text := fmt.Sprintf("%s[%d,%d,%v](", s.RuleName(node.RuleType()), node.StartToken(), node.EndToken(), node.IsToken())
+	for child := range node.ChildNodes() {
+		if child.Parent() != node {
+			return text + "wrong parent)"
+		}
+		text += structure(s, child)
+	}
+	return text + ")"
+}
+
+var formats = []struct {
+	name  string
+	write func(io.Writer, *parser.Parser, *parser.ASTNode, serializer.Options) error
+	read  func(io.Reader, *parser.Syntax) (*parser.ASTNode, error)
+}{
+	{name: "JSON", write: serializer.WriteJSON, read: serializer.ReadJSON},
+	{name: "SExpr", write: serializer.WriteSExpr, read: serializer.ReadSExpr},
+	{name: "XML", write: serializer.WriteXML, read: serializer.ReadXML},
+}
+
+func TestRoundTrip(t *testing.T) {
+	p, root := parse(t, assignsSource)
+	if len(p.Errors()) != 1 {
+		t.Fatalf("got errors %v, want the one of '$'", p.Errors())
+	}
+	want := structure(p.Syntax(), root)
+	if !strings.Contains(want, "Error[") || !strings.Contains(want, ",true](") {
+		t.Fatalf("got tree %s, want error and token nodes", want)
+	}
+	for _, format := range formats {
+		for _, options := range []serializer.Options{{}, {Text: true}, {Text: true, Indent: "  "}} {
+			t.Run(fmt.Sprintf("%s %+v", format.name, options), func(t *testing.T) {
+				written := &bytes.Buffer{}
+				if err := format.write(written, p, root, options); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+				read, err := format.read(bytes.NewReader(written.Bytes()), p.Syntax())
+				if err != nil {
+					t.Fatalf("read failed: %v\n%s", err, written)
+				}
+				if got := structure(p.Syntax(), read); got != want {
+					t.Errorf("got tree %s, want %s", got, want)
+				}
+				rewritten := &bytes.Buffer{}
+				if err := format.write(rewritten, p, read, options); err != nil {
+					t.Fatalf("write of the tree read failed: %v", err)
+				}
+				if rewritten.String() != written.String() {
+					t.Errorf("got %s written again, want %s", rewritten, written)
+				}
+			})
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	p, _ := parse(t, assignsSource)
+	tests := []struct {
+		name   string
+		read   func(io.Reader, *parser.Syntax) (*parser.ASTNode, error)
+		source string
+		want   string
+	}{
+		{name: "JSON unknown rule", read: serializer.ReadJSON, source: `{"rule":"Missing","start":0,"end":0}`, want: "rule 'Missing' not found"},
+		{name: "JSON unknown child rule", read: serializer.ReadJSON, source: `{"rule":"Program","children":[{"rule":"Missing"}]}`, want: "rule 'Missing' not found"},
+		{name: "JSON invalid", read: serializer.ReadJSON, source: `{"rule":`, want: "unexpected EOF"},
+		{name: "SExpr unknown rule", read: serializer.ReadSExpr, source: `(Program (Missing))`, want: "rule 'Missing' not found"},
+		{name: "SExpr unclosed", read: serializer.ReadSExpr, source: `(Program :start 0`, want: "expected ) at position"},
+		{name: "SExpr trailing", read: serializer.ReadSExpr, source: `(Program) x`, want: "unexpected x"},
+		{name: "SExpr unknown field", read: serializer.ReadSExpr, source: `(Program :size 1)`, want: "unknown field :size"},
+		{name: "SExpr invalid value", read: serializer.ReadSExpr, source: `(Program :start a)`, want: "invalid value a of :start"},
+		{name: "SExpr invalid quote", read: serializer.ReadSExpr, source: `(Program :text "a)`, want: "invalid quoted text"},
+		{name: "XML unknown rule", read: serializer.ReadXML, source: `<node rule="Missing"></node>`, want: "rule 'Missing' not found"},
+		{name: "XML invalid", read: serializer.ReadXML, source: `<node rule="Program">`, want: "unexpected EOF"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, err := test.read(strings.NewReader(test.source), p.Syntax())
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got tree %v and error %v, want %q", root, err, test.want)
+			}
+		})
+	}
+}
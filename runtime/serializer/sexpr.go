@@ -0,0 +1,182 @@
+package serializer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// WriteSExpr writes the tree as S-expressions, like (Assign :start 0 :end 3 :row 1 :col 1 (Expr ...)).
+func WriteSExpr(w io.Writer, p *parser.Parser, root *parser.ASTNode, options Options) error {
+	writer := bufio.NewWriter(w)
+	writeSExpr(writer, toNode(p, root, options), options.Indent, 0)
+	writer.WriteString("\n")
+	return writer.Flush()
+}
+
+func writeSExpr(w *bufio.Writer, n *node, indent string, level int) {
+	w.WriteString("(")
+	w.WriteString(symbol(n.Rule))
+	if n.Token {
+		w.WriteString(" :token true")
+	}
+	fmt.Fprintf(w, " :start %d :end %d :row %d :col %d", n.Start, n.End, n.Row, n.Col)
+	if n.Text != nil {
+		w.WriteString(" :text ")
+		w.WriteString(strconv.Quote(*n.Text))
+	}
+	for _, child := range n.Children {
+		if indent == "" {
+			w.WriteString(" ")
+		} else {
+			w.WriteString("\n")
+			w.WriteString(strings.Repeat(indent, level+1))
+		}
+		writeSExpr(w, child, indent, level+1)
+	}
+	w.WriteString(")")
+}
+
+func symbol(name string) string {
+	if name == "" || strings.ContainsAny(name, " \t\r\n()\":") {
+		return strconv.Quote(name)
+	}
+	return name
+}
+
+// ReadSExpr rebuilds a tree written by WriteSExpr, finding the rules by name in the syntax.
+func ReadSExpr(r io.Reader, s *parser.Syntax) (*parser.ASTNode, error) {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reader := &sexprReader{source: string(source)}
+	n, err := reader.node()
+	if err != nil {
+		return nil, err
+	}
+	if atom, _ := reader.next(); atom != "" {
+		return nil, reader.error("unexpected " + atom)
+	}
+	return fromNode(s, n)
+}
+
+type sexprReader struct {
+	source string
+	index  int
+}
+
+func (r *sexprReader) node() (*node, error) {
+	if atom, err := r.next(); err != nil || atom != "(" {
+		return nil, r.expected("(", err)
+	}
+	rule, err := r.next()
+	if err != nil {
+		return nil, err
+	}
+	n := &node{Rule: rule, Children: make([]*node, 0)}
+	for {
+		atom, err := r.peek()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case atom == "":
+			return nil, r.error("expected )")
+		case atom == ")":
+			r.next()
+			return n, nil
+		case atom == "(":
+			child, err := r.node()
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, child)
+		case strings.HasPrefix(atom, ":"):
+			r.next()
+			value, err := r.next()
+			if err != nil {
+				return nil, err
+			}
+			if err = r.setField(n, atom, value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, r.error("unexpected " + atom)
+		}
+	}
+}
+
+func (r *sexprReader) setField(n *node, field string, value string) error {
+	var err error
+	switch field {
+	case ":token":
+		n.Token, err = strconv.ParseBool(value)
+	case ":start":
+		n.Start, err = strconv.Atoi(value)
+	case ":end":
+		n.End, err = strconv.Atoi(value)
+	case ":row":
+		n.Row, err = strconv.Atoi(value)
+	case ":col":
+		n.Col, err = strconv.Atoi(value)
+	case ":text":
+		n.Text = &value
+	default:
+		return r.error("unknown field " + field)
+	}
+	if err != nil {
+		return r.error(fmt.Sprintf("invalid value %s of %s", value, field))
+	}
+	return nil
+}
+
+func (r *sexprReader) peek() (string, error) {
+	index := r.index
+	atom, err := r.next()
+	r.index = index
+	return atom, err
+}
+
+// next returns the next atom, a parenthesis or an empty string at the end of the source.
+// Quoted atoms are returned unquoted.
+func (r *sexprReader) next() (string, error) {
+	for r.index < len(r.source) && strings.IndexByte(" \t\r\n", r.source[r.index]) >= 0 {
+		r.index++
+	}
+	if r.index >= len(r.source) {
+		return "", nil
+	}
+	start := r.index
+	switch r.source[r.index] {
+	case '(', ')':
+		r.index++
+		return r.source[start:r.index], nil
+	case '"':
+		quoted, err := strconv.QuotedPrefix(r.source[start:])
+		if err != nil {
+			return "", r.error("invalid quoted text")
+		}
+		r.index += len(quoted)
+		return strconv.Unquote(quoted)
+	}
+	for r.index < len(r.source) && strings.IndexByte(" \t\r\n()\"", r.source[r.index]) < 0 {
+		r.index++
+	}
+	return r.source[start:r.index], nil
+}
+
+func (r *sexprReader) expected(text string, err error) error {
+	if err != nil {
+		return err
+	}
+	return r.error("expected " + text)
+}
+
+func (r *sexprReader) error(message string) error {
+	return fmt.Errorf("invalid S-expression: %s at position %d", message, r.index+1)
+}
@@ -0,0 +1,28 @@
+package serializer
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+// WriteXML writes the tree as nested node elements, with the rule name in the "rule" attribute.
+func WriteXML(w io.Writer, p *parser.Parser, root *parser.ASTNode, options Options) error {
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", options.Indent)
+	if err := encoder.Encode(toNode(p, root, options)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadXML rebuilds a tree written by WriteXML, finding the rules by name in the syntax.
+func ReadXML(r io.Reader, s *parser.Syntax) (*parser.ASTNode, error) {
+	n := &node{}
+	if err := xml.NewDecoder(r).Decode(n); err != nil {
+		return nil, err
+	}
+	return fromNode(s, n)
+}
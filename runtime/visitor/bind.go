@@ -0,0 +1,76 @@
+package visitor
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+)
+
+var (
+	callbackType       = reflect.TypeOf((*func(*parser.Parser, *parser.ASTNode) (Action, error))(nil)).Elem()
+	simpleCallbackType = reflect.TypeOf((*func(*parser.Parser, *parser.ASTNode))(nil)).Elem()
+)
+
+// Bind creates a visitor with the methods of obj named Enter or Exit followed by
+// the name of a rule, compared ignoring case, like EnterIfStatement. The methods
+// must have the signature of a Callback or take the same arguments and return
+// nothing. Methods named EnterAny and ExitAny are registered for any rule when
+// the syntax has no rule named Any. Bind fails when a method with one of these
+// signatures has a name that does not match any rule, or when a method of a rule
+// has another signature.
+func Bind(syntax *parser.Syntax, obj any) (*RuleVisitor, error) {
+	visitor := New(syntax)
+	value := reflect.ValueOf(obj)
+	errs := make([]error, 0)
+	for i := 0; i < value.NumMethod(); i++ {
+		name := value.Type().Method(i).Name
+		var enter bool
+		var ruleName string
+		if after, found := strings.CutPrefix(name, "Enter"); found {
+			enter, ruleName = true, after
+		} else if after, found := strings.CutPrefix(name, "Exit"); found {
+			ruleName = after
+		} else {
+			continue
+		}
+		ruleId := syntax.RuleId(ruleName)
+		if ruleId > syntax.LastNonTerminal() {
+			ruleId = -1
+		}
+		callback := asCallback(value.Method(i))
+		switch {
+		case callback == nil && ruleId >= 0:
+			errs = append(errs, fmt.Errorf("method %s of rule '%s' is not a visitor callback", name, syntax.RuleName(ruleId)))
+		case callback == nil:
+			continue
+		case ruleId >= 0 && enter:
+			visitor.EnterRule(ruleId, callback)
+		case ruleId >= 0:
+			visitor.ExitRule(ruleId, callback)
+		case strings.EqualFold(ruleName, "Any") && enter:
+			visitor.EnterAny(callback)
+		case strings.EqualFold(ruleName, "Any"):
+			visitor.ExitAny(callback)
+		default:
+			errs = append(errs, fmt.Errorf("method %s does not match any rule", name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return visitor, nil
+}
+
+func asCallback(method reflect.Value) Callback {
+	switch method.Type() {
+	case callbackType:
+		return method.Interface().(func(*parser.Parser, *parser.ASTNode) (Action, error))
+	case simpleCallbackType:
+		return Simple(method.Interface().(func(*parser.Parser, *parser.ASTNode)))
+	default:
+		return nil
+	}
+}
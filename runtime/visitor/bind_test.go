@@ -0,0 +1,83 @@
+package visitor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/runtime/visitor"
+)
+
+type namesBinder struct {
+	recorder
+}
+
+func (b *namesBinder) EnterAny(p *parser.Parser, node *parser.ASTNode) {
+	b.events = append(b.events, "+"+p.Syntax().RuleName(node.RuleType()))
+}
+
+func (b *namesBinder) EnterASSIGN(p *parser.Parser, node *parser.ASTNode) (visitor.Action, error) {
+	b.events = append(b.events, "*"+p.NodeText(node))
+	return visitor.SKIP_CHILDREN, nil
+}
+
+func (b *namesBinder) ExitBlock(p *parser.Parser, node *parser.ASTNode) {
+	b.events = append(b.events, "-Block")
+}
+
+// EnterScope does not match any rule, but it is not a visitor callback.
+func (b *namesBinder) EnterScope(name string) {
+	b.events = append(b.events, "scope "+name)
+}
+
+func (b *namesBinder) Names() []string {
+	return b.events
+}
+
+func TestBind(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	binder := &namesBinder{}
+	v, err := visitor.Bind(p.Syntax(), binder)
+	if err != nil {
+		t.Fatalf("bind failed: %v", err)
+	}
+	if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	want := "+Program +Stmt +Assign *a = f(b); +Stmt +Block +Stmt +Assign *c = 1; -Block"
+	if got := binder.String(); got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+}
+
+type badSignatures struct{}
+
+func (badSignatures) EnterCall(p *parser.Parser) {}
+
+func (badSignatures) ExitName(p *parser.Parser, node *parser.ASTNode) error {
+	return nil
+}
+
+func (badSignatures) EnterStatement(p *parser.Parser, node *parser.ASTNode) {}
+
+func (badSignatures) ExitExpr(p *parser.Parser, node *parser.ASTNode) {}
+
+func TestBindErrors(t *testing.T) {
+	p, _ := parse(t, blocksSource)
+	v, err := visitor.Bind(p.Syntax(), badSignatures{})
+	if v != nil || err == nil {
+		t.Fatalf("got visitor %v and error %v, want an error", v, err)
+	}
+	for _, want := range []string{
+		"method EnterCall of rule 'Call' is not a visitor callback",
+		"method ExitName of rule 'Name' is not a visitor callback",
+		"method EnterStatement does not match any rule",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "ExitExpr") {
+		t.Errorf("got error %v for a valid method", err)
+	}
+}
@@ -2,33 +2,72 @@ package visitor
 
 import (
 	"fmt"
+	"path"
+	"strings"
 
 	"github.com/fabiouggeri/page/runtime/parser"
 )
 
+// Action tells the walker how to go on after a callback.
+type Action int
+
+const (
+	// CONTINUE walks the children of the node and then the rest of the tree.
+	CONTINUE Action = iota
+	// SKIP_CHILDREN does not walk the children of the node entered. The exit
+	// callbacks of the node are still called.
+	SKIP_CHILDREN
+	// STOP ends the walk of the visitor without calling any other of its callbacks.
+	STOP
+)
+
+// Callback is called when the walker enters or exits a node. A callback that
+// returns an error stops the walk, and the error is returned by Walk.
+type Callback func(parser *parser.Parser, node *parser.ASTNode) (Action, error)
+
+// Simple adapts a callback written before callbacks returned an action and an
+// error. The callback always continues the walk.
+func Simple(callback func(parser *parser.Parser, node *parser.ASTNode)) Callback {
+	return func(p *parser.Parser, node *parser.ASTNode) (Action, error) {
+		callback(p, node)
+		return CONTINUE, nil
+	}
+}
+
+// RuleVisitor holds the callbacks called for the nodes of the rules. Many
+// callbacks may be registered for the same rule and they are called in the
+// order they were registered, after the EnterAny callbacks on enter and before
+// the ExitAny callbacks on exit. The actions of all the callbacks of a node are
+// combined, so one of them skipping the children skips them for the whole
+// visitor. Independent analyses should use their own visitors, walked together
+// by a single walker.
 type RuleVisitor struct {
 	syntax             *parser.Syntax
-	enterRuleCallbacks map[int]func(parser *parser.Parser, node *parser.ASTNode)
-	exitRuleCallbacks  map[int]func(parser *parser.Parser, node *parser.ASTNode)
+	enterRuleCallbacks map[int][]Callback
+	exitRuleCallbacks  map[int][]Callback
+	enterAnyCallbacks  []Callback
+	exitAnyCallbacks   []Callback
 }
 
 func New(s *parser.Syntax) *RuleVisitor {
 	return &RuleVisitor{
 		syntax:             s,
-		enterRuleCallbacks: make(map[int]func(parser *parser.Parser, node *parser.ASTNode)),
-		exitRuleCallbacks:  make(map[int]func(parser *parser.Parser, node *parser.ASTNode)),
+		enterRuleCallbacks: make(map[int][]Callback),
+		exitRuleCallbacks:  make(map[int][]Callback),
+		enterAnyCallbacks:  make([]Callback, 0),
+		exitAnyCallbacks:   make([]Callback, 0),
 	}
 }
 
-func (l *RuleVisitor) EnterRule(ruleId int, callback func(parser *parser.Parser, node *parser.ASTNode)) error {
+func (l *RuleVisitor) EnterRule(ruleId int, callback Callback) error {
 	if ruleId < 0 || ruleId > l.syntax.LastNonTerminal() {
 		return fmt.Errorf("rule id %d not found", ruleId)
 	}
-	l.enterRuleCallbacks[ruleId] = callback
+	l.enterRuleCallbacks[ruleId] = append(l.enterRuleCallbacks[ruleId], callback)
 	return nil
 }
 
-func (l *RuleVisitor) EnterRuleName(ruleName string, callback func(parser *parser.Parser, node *parser.ASTNode)) error {
+func (l *RuleVisitor) EnterRuleName(ruleName string, callback Callback) error {
 	ruleId := l.syntax.RuleId(ruleName)
 	if ruleId < 0 {
 		return fmt.Errorf("rule '%s' not found", ruleName)
@@ -36,18 +75,103 @@ func (l *RuleVisitor) EnterRuleName(ruleName string, callback func(parser *parse
 	return l.EnterRule(ruleId, callback)
 }
 
-func (l *RuleVisitor) ExitRule(ruleId int, callback func(parser *parser.Parser, node *parser.ASTNode)) error {
+// EnterRulePattern registers the callback for the rules with names matching the
+// pattern, ignoring case. The syntax of the pattern is the one of path.Match,
+// like "*Statement" or "Expr?".
+func (l *RuleVisitor) EnterRulePattern(pattern string, callback Callback) error {
+	rulesIds, err := l.matchRules(pattern)
+	if err != nil {
+		return err
+	}
+	for _, ruleId := range rulesIds {
+		l.enterRuleCallbacks[ruleId] = append(l.enterRuleCallbacks[ruleId], callback)
+	}
+	return nil
+}
+
+// EnterAny registers a callback called when entering the nodes of any rule.
+func (l *RuleVisitor) EnterAny(callback Callback) {
+	l.enterAnyCallbacks = append(l.enterAnyCallbacks, callback)
+}
+
+func (l *RuleVisitor) ExitRule(ruleId int, callback Callback) error {
 	if ruleId < 0 || ruleId > l.syntax.LastNonTerminal() {
 		return fmt.Errorf("rule id %d not found", ruleId)
 	}
-	l.exitRuleCallbacks[ruleId] = callback
+	l.exitRuleCallbacks[ruleId] = append(l.exitRuleCallbacks[ruleId], callback)
 	return nil
 }
 
-func (l *RuleVisitor) ExitRuleName(ruleName string, callback func(parser *parser.Parser, node *parser.ASTNode)) error {
+func (l *RuleVisitor) ExitRuleName(ruleName string, callback Callback) error {
 	ruleId := l.syntax.RuleId(ruleName)
 	if ruleId < 0 {
 		return fmt.Errorf("rule '%s' not found", ruleName)
 	}
 	return l.ExitRule(ruleId, callback)
 }
+
+// ExitRulePattern registers the callback for the rules with names matching the
+// pattern, like EnterRulePattern.
+func (l *RuleVisitor) ExitRulePattern(pattern string, callback Callback) error {
+	rulesIds, err := l.matchRules(pattern)
+	if err != nil {
+		return err
+	}
+	for _, ruleId := range rulesIds {
+		l.exitRuleCallbacks[ruleId] = append(l.exitRuleCallbacks[ruleId], callback)
+	}
+	return nil
+}
+
+// ExitAny registers a callback called when exiting the nodes of any rule.
+func (l *RuleVisitor) ExitAny(callback Callback) {
+	l.exitAnyCallbacks = append(l.exitAnyCallbacks, callback)
+}
+
+func (l *RuleVisitor) matchRules(pattern string) ([]int, error) {
+	rulesIds := make([]int, 0)
+	for ruleId := 0; ruleId <= l.syntax.LastNonTerminal(); ruleId++ {
+		matched, err := path.Match(strings.ToLower(pattern), strings.ToLower(l.syntax.RuleName(ruleId)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule pattern '%s'", pattern)
+		}
+		if matched {
+			rulesIds = append(rulesIds, ruleId)
+		}
+	}
+	if len(rulesIds) == 0 {
+		return nil, fmt.Errorf("no rule matches '%s'", pattern)
+	}
+	return rulesIds, nil
+}
+
+func (l *RuleVisitor) enter(p *parser.Parser, node *parser.ASTNode) (Action, error) {
+	action, err := call(l.enterAnyCallbacks, p, node, CONTINUE)
+	if err != nil || action == STOP {
+		return action, err
+	}
+	return call(l.enterRuleCallbacks[node.RuleType()], p, node, action)
+}
+
+func (l *RuleVisitor) exit(p *parser.Parser, node *parser.ASTNode) (Action, error) {
+	action, err := call(l.exitRuleCallbacks[node.RuleType()], p, node, CONTINUE)
+	if err != nil || action == STOP {
+		return action, err
+	}
+	return call(l.exitAnyCallbacks, p, node, action)
+}
+
+// call calls the callbacks until one of them stops, combining their actions.
+func call(callbacks []Callback, p *parser.Parser, node *parser.ASTNode, action Action) (Action, error) {
+	for _, callback := range callbacks {
+		result, err := callback(p, node)
+		if err != nil {
+			return STOP, err
+		}
+		action = max(action, result)
+		if action == STOP {
+			return STOP, nil
+		}
+	}
+	return action, nil
+}
@@ -0,0 +1,317 @@
+package visitor_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fabiouggeri/page/build/grammar"
+	"github.com/fabiouggeri/page/build/syntax"
+	"github.com/fabiouggeri/page/build/vocabulary"
+	"github.com/fabiouggeri/page/runtime/input"
+	"github.com/fabiouggeri/page/runtime/lexer"
+	"github.com/fabiouggeri/page/runtime/parser"
+	"github.com/fabiouggeri/page/runtime/visitor"
+)
+
+const blocksGrammar = `grammar Blocks;
+
+Program : Stmt* EOI;
+
+Stmt : Assign | Block;
+
+Assign : Name '=' Expr ';';
+
+Block : '{' Stmt* '}';
+
+Expr : Call | Name | Number;
+
+Call : Name '(' Expr? ')';
+
+Name : Ident;
+
+Ident : [a-z]+;
+
+Number : [0-9]+;
+
+@Ignore
+Spaces : (' ' | '\t' | '\n')+;
+`
+
+const blocksSource = "a = f(b); { c = 1; }"
+
+// parse parses the source with the grammar of blocks.
+func parse(t testing.TB, source string) (*parser.Parser, *parser.ASTNode) {
+	t.Helper()
+	g, err := grammar.FromString(blocksGrammar)
+	if err != nil {
+		t.Fatalf("invalid grammar: %v", err)
+	}
+	v := vocabulary.FromGrammar(g)
+	p := parser.New(lexer.New(v, input.NewStringInput(source)), syntax.FromGrammar(g, v))
+	root := p.Execute()
+	if root == nil {
+		t.Fatalf("parse failed: %v", p.Errors())
+	}
+	return p, root
+}
+
+// recorder keeps the events of the callbacks, like "+Assign" when entering an
+// Assign node and "-Assign" when exiting it.
+type recorder struct {
+	events []string
+}
+
+func (r *recorder) callback(prefix string, action visitor.Action) visitor.Callback {
+	return func(p *parser.Parser, node *parser.ASTNode) (visitor.Action, error) {
+		r.events = append(r.events, prefix+p.Syntax().RuleName(node.RuleType()))
+		return action, nil
+	}
+}
+
+// record registers callbacks for any rule that record the events.
+func (r *recorder) record(v *visitor.RuleVisitor) {
+	v.EnterAny(r.callback("+", visitor.CONTINUE))
+	v.ExitAny(r.callback("-", visitor.CONTINUE))
+}
+
+func (r *recorder) String() string {
+	return strings.Join(r.events, " ")
+}
+
+func TestWalk(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	r := &recorder{}
+	v := visitor.New(p.Syntax())
+	r.record(v)
+	if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	want := "+Program +Stmt +Assign +Name -Name +Expr +Call +Name -Name +Expr +Name -Name -Expr -Call -Expr -Assign -Stmt " +
+		"+Stmt +Block +Stmt +Assign +Name -Name +Expr -Expr -Assign -Stmt -Block -Stmt -Program"
+	if got := r.String(); got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		enter  visitor.Action
+		exit   visitor.Action
+		events string
+	}{
+		{
+			name:   "skip children",
+			enter:  visitor.SKIP_CHILDREN,
+			events: "+Program +Stmt +Assign +Name -Name +Expr +Call *Call -Call -Expr -Assign -Stmt +Stmt +Block +Stmt +Assign +Name -Name +Expr -Expr -Assign -Stmt -Block -Stmt -Program",
+		},
+		{
+			name:   "stop on enter",
+			enter:  visitor.STOP,
+			events: "+Program +Stmt +Assign +Name -Name +Expr +Call *Call",
+		},
+		{
+			name:   "stop on exit",
+			exit:   visitor.STOP,
+			events: "+Program +Stmt +Assign +Name -Name +Expr +Call +Name -Name +Expr +Name -Name -Expr *Call",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, root := parse(t, blocksSource)
+			r := &recorder{}
+			v := visitor.New(p.Syntax())
+			r.record(v)
+			if test.enter != visitor.CONTINUE {
+				if err := v.EnterRuleName("Call", r.callback("*", test.enter)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.exit != visitor.CONTINUE {
+				if err := v.ExitRuleName("Call", r.callback("*", test.exit)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+				t.Fatalf("walk failed: %v", err)
+			}
+			if got := r.String(); got != test.events {
+				t.Errorf("got events %s, want %s", got, test.events)
+			}
+		})
+	}
+}
+
+func TestCallbackErrors(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	failure := errors.New("no blocks")
+	for _, enter := range []bool{true, false} {
+		r := &recorder{}
+		v := visitor.New(p.Syntax())
+		r.record(v)
+		fail := func(p *parser.Parser, node *parser.ASTNode) (visitor.Action, error) {
+			return visitor.CONTINUE, failure
+		}
+		want := "+Program +Stmt +Assign +Name -Name +Expr +Call +Name -Name +Expr +Name -Name -Expr -Call -Expr -Assign -Stmt +Stmt +Block"
+		if enter {
+			v.EnterRuleName("Block", fail)
+		} else {
+			v.ExitRuleName("Block", fail)
+			want += " +Stmt +Assign +Name -Name +Expr -Expr -Assign -Stmt"
+		}
+		if err := visitor.NewWalker(p, v).Walk(root); err != failure {
+			t.Errorf("got error %v, want %v", err, failure)
+		}
+		if got := r.String(); got != want {
+			t.Errorf("got events %s, want %s", got, want)
+		}
+	}
+}
+
+func TestSimpleCallbacks(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	names := make([]string, 0)
+	v := visitor.New(p.Syntax())
+	v.EnterRuleName("Name", visitor.Simple(func(p *parser.Parser, node *parser.ASTNode) {
+		names = append(names, p.NodeText(node))
+	}))
+	if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	if want := []string{"a", "f", "b", "c"}; !slices.Equal(names, want) {
+		t.Errorf("got names %v, want %v", names, want)
+	}
+	if err := visitor.NewWalker(p, v).Walk(nil); err != nil {
+		t.Errorf("got error %v walking no tree", err)
+	}
+}
+
+func TestManyCallbacks(t *testing.T) {
+	p, root := parse(t, "a = 1;")
+	r := &recorder{}
+	v := visitor.New(p.Syntax())
+	v.EnterRuleName("Assign", r.callback("1+", visitor.CONTINUE))
+	v.ExitRuleName("Assign", r.callback("1-", visitor.CONTINUE))
+	r.record(v)
+	v.EnterRuleName("Assign", r.callback("2+", visitor.CONTINUE))
+	v.ExitRuleName("Assign", r.callback("2-", visitor.CONTINUE))
+	v.EnterAny(r.callback("any+", visitor.CONTINUE))
+	if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	// the callbacks of any rule enter first and exit last
+	want := "+Program any+Program +Stmt any+Stmt +Assign any+Assign 1+Assign 2+Assign +Name any+Name -Name +Expr any+Expr -Expr " +
+		"1-Assign 2-Assign -Assign -Stmt -Program"
+	if got := r.String(); got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+}
+
+func TestCombinedActions(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	r := &recorder{}
+	v := visitor.New(p.Syntax())
+	r.record(v)
+	// one callback skipping the children skips them for the whole visitor, and
+	// the callbacks after one that stops are not called
+	v.EnterRuleName("Assign", r.callback("*", visitor.SKIP_CHILDREN))
+	v.EnterRuleName("Assign", r.callback("*", visitor.CONTINUE))
+	v.EnterRuleName("Block", r.callback("*", visitor.STOP))
+	v.EnterRuleName("Block", r.callback("*", visitor.CONTINUE))
+	if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	want := "+Program +Stmt +Assign *Assign *Assign -Assign -Stmt +Stmt +Block *Block"
+	if got := r.String(); got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+}
+
+func TestRulePatterns(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	r := &recorder{}
+	v := visitor.New(p.Syntax())
+	if err := v.EnterRulePattern("*ss*", r.callback("+", visitor.CONTINUE)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.ExitRulePattern("[bc]*", r.callback("-", visitor.CONTINUE)); err != nil {
+		t.Fatal(err)
+	}
+	if err := visitor.NewWalker(p, v).Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	want := "+Assign -Call +Assign -Block"
+	if got := r.String(); got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+	tests := []struct {
+		name     string
+		register func() error
+		want     string
+	}{
+		{name: "unknown rule name", register: func() error { return v.EnterRuleName("Missing", nil) }, want: "rule 'Missing' not found"},
+		{name: "unknown rule name on exit", register: func() error { return v.ExitRuleName("Missing", nil) }, want: "rule 'Missing' not found"},
+		{name: "rule id out of range", register: func() error { return v.EnterRule(p.Syntax().LastNonTerminal()+1, nil) }, want: "not found"},
+		{name: "negative rule id", register: func() error { return v.ExitRule(-1, nil) }, want: "rule id -1 not found"},
+		{name: "pattern without rules", register: func() error { return v.EnterRulePattern("*Statement", nil) }, want: "no rule matches '*Statement'"},
+		{name: "invalid pattern", register: func() error { return v.ExitRulePattern("[a", nil) }, want: "invalid rule pattern '[a'"},
+	}
+	for _, test := range tests {
+		if err := test.register(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestComposedVisitors(t *testing.T) {
+	p, root := parse(t, blocksSource)
+	skipping, stopping := &recorder{}, &recorder{}
+	skip := visitor.New(p.Syntax())
+	skip.EnterRuleName("Stmt", skipping.callback("*", visitor.SKIP_CHILDREN))
+	skipping.record(skip)
+	stop := visitor.New(p.Syntax())
+	stopping.record(stop)
+	stop.EnterRuleName("Call", stopping.callback("*", visitor.STOP))
+	all := &recorder{}
+	full := visitor.New(p.Syntax())
+	all.record(full)
+	walker := visitor.NewWalker(p, skip, stop, full)
+	if err := walker.Walk(root); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	// the actions of each visitor do not change the walk of the others
+	tests := []struct {
+		name   string
+		events *recorder
+		want   string
+	}{
+		{name: "skipping", events: skipping, want: "+Program +Stmt *Stmt -Stmt +Stmt *Stmt -Stmt -Program"},
+		{name: "stopping", events: stopping, want: "+Program +Stmt +Assign +Name -Name +Expr +Call *Call"},
+		{
+			name:   "full",
+			events: all,
+			want: "+Program +Stmt +Assign +Name -Name +Expr +Call +Name -Name +Expr +Name -Name -Expr -Call -Expr -Assign -Stmt " +
+				"+Stmt +Block +Stmt +Assign +Name -Name +Expr -Expr -Assign -Stmt -Block -Stmt -Program",
+		},
+	}
+	for _, test := range tests {
+		if got := test.events.String(); got != test.want {
+			t.Errorf("%s: got events %s, want %s", test.name, got, test.want)
+		}
+	}
+	// an error stops all the visitors
+	failure := errors.New("failed")
+	fail := visitor.New(p.Syntax())
+	fail.ExitRuleName("Call", func(p *parser.Parser, node *parser.ASTNode) (visitor.Action, error) {
+		return visitor.CONTINUE, failure
+	})
+	all.events = nil
+	if err := visitor.NewWalker(p, full, fail).Walk(root); err != failure {
+		t.Errorf("got error %v, want %v", err, failure)
+	}
+	if got, want := all.String(), "+Program +Stmt +Assign +Name -Name +Expr +Call +Name -Name +Expr +Name -Name -Expr -Call"; got != want {
+		t.Errorf("got events %s, want %s", got, want)
+	}
+}
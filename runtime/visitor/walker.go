@@ -2,35 +2,106 @@ package visitor
 
 import "github.com/fabiouggeri/page/runtime/parser"
 
+// ASTWalker walks a tree calling the callbacks of one or more visitors. Each
+// visitor has its own actions: skipping the children of a node or stopping
+// affects only the visitor whose callback asked for it.
 type ASTWalker struct {
-	parser  *parser.Parser
-	visitor *RuleVisitor
+	parser   *parser.Parser
+	visitors []*RuleVisitor
+	stopped  []bool
 }
 
-func NewWalker(parser *parser.Parser, visitor *RuleVisitor) *ASTWalker {
+func NewWalker(parser *parser.Parser, visitors ...*RuleVisitor) *ASTWalker {
 	return &ASTWalker{
-		parser:  parser,
-		visitor: visitor,
+		parser:   parser,
+		visitors: visitors,
 	}
 }
 
-func (w *ASTWalker) Walk(node *parser.ASTNode) {
+// Walk calls the callbacks of the visitors for the node and its descendants. It
+// returns the error of the callback that stopped the walk, if any. The walk
+// keeps its own stack, so it does not recurse on deep trees.
+func (w *ASTWalker) Walk(node *parser.ASTNode) error {
 	if node == nil {
-		return
+		return nil
 	}
+	w.stopped = make([]bool, len(w.visitors))
+	active := make([]bool, len(w.visitors))
+	for i := range active {
+		active[i] = true
+	}
+	frame, err := w.enter(node, active)
+	if err != nil {
+		return err
+	}
+	stack := []*walkFrame{frame}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if child := top.next; child != nil && !w.allStopped() {
+			top.next = child.Sibling()
+			frame, err := w.enter(child, top.childrenActive)
+			if err != nil {
+				return err
+			}
+			stack = append(stack, frame)
+			continue
+		}
+		if err := w.exit(top); err != nil {
+			return err
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return nil
+}
 
-	ruleId := node.RuleType()
-	if callback, exists := w.visitor.enterRuleCallbacks[ruleId]; exists {
-		callback(w.parser, node)
+// walkFrame is a node entered by the walker, with the visitors walking it, the
+// visitors walking its children and the next child to walk.
+type walkFrame struct {
+	node           *parser.ASTNode
+	active         []bool
+	childrenActive []bool
+	next           *parser.ASTNode
+}
+
+// enter calls the enter callbacks of the active visitors, the ones not skipping the node.
+func (w *ASTWalker) enter(node *parser.ASTNode, active []bool) (*walkFrame, error) {
+	frame := &walkFrame{node: node, active: active, childrenActive: make([]bool, len(w.visitors))}
+	for i, visitor := range w.visitors {
+		if !active[i] || w.stopped[i] {
+			continue
+		}
+		action, err := visitor.enter(w.parser, node)
+		if err != nil {
+			return nil, err
+		}
+		w.stopped[i] = action == STOP
+		frame.childrenActive[i] = action == CONTINUE
+		if frame.childrenActive[i] {
+			frame.next = node.FirstChild()
+		}
 	}
+	return frame, nil
+}
 
-	child := node.FirstChild()
-	for child != nil {
-		w.Walk(child)
-		child = child.Sibling()
+func (w *ASTWalker) exit(frame *walkFrame) error {
+	for i, visitor := range w.visitors {
+		if !frame.active[i] || w.stopped[i] {
+			continue
+		}
+		action, err := visitor.exit(w.parser, frame.node)
+		if err != nil {
+			return err
+		}
+		w.stopped[i] = action == STOP
 	}
+	return nil
+}
 
-	if callback, exists := w.visitor.exitRuleCallbacks[ruleId]; exists {
-		callback(w.parser, node)
+func (w *ASTWalker) allStopped() bool {
+	for _, stopped := range w.stopped {
+		if !stopped {
+			return false
+		}
 	}
+	return true
 }